@@ -8,10 +8,11 @@ import (
 	"github.com/onlythinking/pug-go/internal/config"
 	"github.com/onlythinking/pug-go/internal/pdl/advance"
 	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
 	"github.com/onlythinking/pug-go/pkg/logging"
 	"github.com/onlythinking/pug-go/pkg/oss/pugaws"
+	"github.com/onlythinking/pug-go/pkg/pughttp"
 	"github.com/sethvargo/go-signalcontext"
-	"sync"
 	"time"
 )
 
@@ -23,8 +24,12 @@ func main() {
 	logger := logging.DefaultLogger()
 
 	cfgPath := "config/config.yml"
+	config.InitConfigFile(cfgPath)
 
 	appConfig := config.App()
+	if err := loan.InitFieldCipher(); err != nil {
+		panic(err)
+	}
 
 	fmt.Println(appConfig)
 
@@ -43,11 +48,22 @@ func main() {
 	dbStatsContent, err := json.Marshal(dbStats)
 	logger.Infof("Mysql db pool: %s", string(dbStatsContent))
 
+	db.SetLogger(logging.NewGormLogger(logger))
 	db.LogMode(true)
 	downloader := pugaws.NewS3Downloader()
+	httpClient, err := pughttp.New(appConfig.Pdl.HttpClient)
+	if err != nil {
+		panic(err)
+	}
 	advOcrClient := advance.NewAdvOcrClient("PAN_FRONT")
+	advOcrClient.SetHTTPClient(httpClient)
+	ocrProviders, err := ocr.NewSelectorFromConfig([]ocr.Provider{advOcrClient}, appConfig.Pdl.Ocr)
+	if err != nil {
+		panic(err)
+	}
 
-	loan.Init(db, downloader, advOcrClient)
+	svc := loan.NewService(loan.NewGormRepos(db), downloader, ocrProviders)
+	svc.SetHTTPClient(httpClient)
 
 	<-ctx.Done()
 
@@ -0,0 +1,90 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/pkg/help"
+	"github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/onlythinking/pug-go/pkg/pughttp"
+	"github.com/sethvargo/go-signalcontext"
+	"github.com/spf13/cobra"
+)
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Manage third-party call records sent to the event server",
+}
+
+// eventsReplayCmd represents the events replay command
+var eventsReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Resend undelivered third-party call records",
+	Long: `Resend every record in pdl_event_outbox that has not been delivered yet,
+including records that gave up after the maximum number of attempts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfgPath, _ := cmd.Flags().GetString("config")
+		if ok, err := help.PathExists(cfgPath); !ok || err != nil {
+			panic("Config file not found.")
+		}
+		replayEvents(cfgPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.AddCommand(eventsReplayCmd)
+	eventsReplayCmd.Flags().StringP("config", "c", "config.yml", "Config file path")
+}
+
+func replayEvents(cfgPath string) {
+	ctx, cancel := signalcontext.OnInterrupt()
+	defer cancel()
+
+	logger := logging.DefaultLogger()
+	config.InitConfigFile(cfgPath)
+	appConfig := config.App()
+	if err := loan.InitFieldCipher(); err != nil {
+		logger.Errorf("Init field cipher err: %s", err)
+		return
+	}
+
+	httpClient, err := pughttp.New(appConfig.Pdl.HttpClient)
+	if err != nil {
+		panic(err)
+	}
+	db := openDB(logger)
+	if err := checkSchema(db); err != nil {
+		logger.Errorf("Check schema err: %s", err)
+		return
+	}
+	svc := loan.NewService(loan.NewGormRepos(db), nil, nil)
+	svc.SetHTTPClient(httpClient)
+
+	delivered, failed, err := svc.NewEventSender().Replay(ctx)
+	if err != nil {
+		logger.Errorf("Replay err: %s", err)
+		return
+	}
+	remaining, err := svc.UndeliveredEvents()
+	if err != nil {
+		logger.Errorf("Count undelivered err: %s", err)
+		return
+	}
+	logger.Infof("Replayed: delivered %d, failed %d, undelivered %d", delivered, failed, remaining)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/pkg/help"
+	"github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+const dateLayout = "2006-01-02"
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export OCR results of the input data as an Excel or CSV report",
+	Long: `Join the input data with cu_cust_ocr_result_dtl and the job ledger and write
+an .xlsx or .csv report, one line per input row.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := exportOptions{}
+		opts.data, _ = cmd.Flags().GetString("data")
+		opts.source, _ = cmd.Flags().GetString("source")
+		opts.cfgPath, _ = cmd.Flags().GetString("config")
+		opts.out, _ = cmd.Flags().GetString("out")
+		statuses, _ := cmd.Flags().GetStringSlice("status")
+		busiTypes, _ := cmd.Flags().GetStringSlice("busi-type")
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+
+		opts.filter = loan.ExportFilter{Statuses: statuses, BusiTypes: busiTypes}
+		var err error
+		if opts.filter.From, err = parseDate(from); err != nil {
+			return err
+		}
+		if opts.filter.To, err = parseDate(to); err != nil {
+			return err
+		}
+		// 结束日期当天包含在内
+		if !opts.filter.To.IsZero() {
+			opts.filter.To = opts.filter.To.AddDate(0, 0, 1)
+		}
+		if ok, err := help.PathExists(opts.cfgPath); !ok || err != nil {
+			panic("Config file not found.")
+		}
+		export(opts)
+		return nil
+	},
+}
+
+type exportOptions struct {
+	data    string
+	source  string
+	cfgPath string
+	out     string
+	filter  loan.ExportFilter
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringP("config", "c", "config.yml", "Config file path")
+	exportCmd.Flags().StringP("data", "f", "excel/pan_all.xlsx", "Data file path (.xlsx, .csv, .jsonl, .sql) or SQL query with --source sql")
+	exportCmd.Flags().String("source", "", "Data source: excel | csv | jsonl | sql, detected from the file extension by default")
+	exportCmd.Flags().StringP("out", "o", "pan_report.xlsx", "Report path, .xlsx or .csv")
+	exportCmd.Flags().String("from", "", "Only rows processed on or after this date (yyyy-MM-dd)")
+	exportCmd.Flags().String("to", "", "Only rows processed on or before this date (yyyy-MM-dd)")
+	exportCmd.Flags().StringSlice("status", nil, "Only rows with these statuses: SUCCEEDED, FAILED, SKIPPED, PENDING, IN_FLIGHT, NOT_STARTED")
+	exportCmd.Flags().StringSlice("busi-type", nil, "Only rows with these busiTypes")
+}
+
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(dateLayout, value, time.Local)
+}
+
+func export(opts exportOptions) {
+	logger := logging.DefaultLogger()
+	config.InitConfigFile(opts.cfgPath)
+	if err := loan.InitFieldCipher(); err != nil {
+		logger.Errorf("Init field cipher err: %s", err)
+		return
+	}
+
+	db := openDB(logger)
+	if err := checkSchema(db); err != nil {
+		logger.Errorf("Check schema err: %s", err)
+		return
+	}
+	svc := loan.NewService(loan.NewGormRepos(db), nil, nil)
+
+	src, err := loan.OpenSource(db, opts.source, opts.data)
+	if err != nil {
+		logger.Errorf("Open source err: %s", err)
+		return
+	}
+	count, err := svc.ExportReport(src, opts.filter, opts.out)
+	if err != nil {
+		logger.Errorf("Export err: %s", err)
+		return
+	}
+	logger.Infof("Exported %d rows to %s", count, opts.out)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jinzhu/gorm"
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/migrations"
+	"github.com/onlythinking/pug-go/pkg/help"
+	"github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/onlythinking/pug-go/pkg/migrate"
+	"github.com/sethvargo/go-signalcontext"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the database schema of pdl tables",
+	Long: `Apply or roll back the versioned SQL migrations bundled into the binary.
+Applied versions are recorded in the schema_version table.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cfgPath, _ := cmd.Flags().GetString("config")
+		if ok, err := help.PathExists(cfgPath); !ok || err != nil {
+			panic("Config file not found.")
+		}
+		config.InitConfigFile(cfgPath)
+	},
+}
+
+// migrateUpCmd represents the migrate up command
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		steps, _ := cmd.Flags().GetInt("steps")
+		runMigrations(func(ctx context.Context, m *migrate.Migrator) ([]migrate.Migration, error) {
+			return m.Up(ctx, steps)
+		})
+	},
+}
+
+// migrateDownCmd represents the migrate down command
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back the latest applied migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		steps, _ := cmd.Flags().GetInt("steps")
+		runMigrations(func(ctx context.Context, m *migrate.Migrator) ([]migrate.Migration, error) {
+			return m.Down(ctx, steps)
+		})
+	},
+}
+
+// migrateStatusCmd represents the migrate status command
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := logging.DefaultLogger()
+		m, err := migrations.NewMigrator(openDB(logger).DB())
+		if err != nil {
+			logger.Errorf("Load migrations err: %s", err)
+			return
+		}
+		states, err := m.Status(context.Background())
+		if err != nil {
+			logger.Errorf("Migration status err: %s", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range states {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedTime.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+	migrateCmd.PersistentFlags().StringP("config", "c", "config.yml", "Config file path")
+	migrateUpCmd.Flags().IntP("steps", "n", 0, "Number of migrations to apply, all pending by default")
+	migrateDownCmd.Flags().IntP("steps", "n", 1, "Number of migrations to roll back")
+}
+
+func runMigrations(fn func(ctx context.Context, m *migrate.Migrator) ([]migrate.Migration, error)) {
+	ctx, cancel := signalcontext.OnInterrupt()
+	defer cancel()
+
+	logger := logging.DefaultLogger()
+	m, err := migrations.NewMigrator(openDB(logger).DB())
+	if err != nil {
+		logger.Errorf("Load migrations err: %s", err)
+		return
+	}
+	done, err := fn(ctx, m)
+	for _, migration := range done {
+		logger.Infof("Migrated %04d_%s", migration.Version, migration.Name)
+	}
+	if err != nil {
+		logger.Errorf("Migrate err: %s", err)
+		return
+	}
+	if len(done) == 0 {
+		logger.Info("Nothing to migrate")
+	}
+}
+
+// 存在未执行的迁移时拒绝处理数据
+func checkSchema(db *gorm.DB) error {
+	m, err := migrations.NewMigrator(db.DB())
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, run `pdl migrate up` first", len(pending))
+	}
+	return nil
+}
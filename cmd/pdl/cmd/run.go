@@ -23,11 +23,15 @@ import (
 	"github.com/onlythinking/pug-go/internal/config"
 	"github.com/onlythinking/pug-go/internal/pdl/advance"
 	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
 	"github.com/onlythinking/pug-go/pkg/help"
 	"github.com/onlythinking/pug-go/pkg/logging"
 	"github.com/onlythinking/pug-go/pkg/oss/pugaws"
+	"github.com/onlythinking/pug-go/pkg/pughttp"
 	"github.com/sethvargo/go-signalcontext"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"os"
 	"time"
 )
 
@@ -37,34 +41,135 @@ var runCmd = &cobra.Command{
 	Short: "Download pan img or request advance ocr",
 	Long:  `Download pan img or request advance ocr`,
 	Run: func(cmd *cobra.Command, args []string) {
-		step, _ := cmd.Flags().GetString("type")
-		excelPath, _ := cmd.Flags().GetString("data")
-		cfgPath, _ := cmd.Flags().GetString("config")
-		if ok, err := help.PathExists(cfgPath); !ok || err != nil {
+		opts := runOptions{}
+		opts.step, _ = cmd.Flags().GetString("type")
+		opts.data, _ = cmd.Flags().GetString("data")
+		opts.source, _ = cmd.Flags().GetString("source")
+		opts.startRow, _ = cmd.Flags().GetInt("start-row")
+		opts.cfgPath, _ = cmd.Flags().GetString("config")
+		opts.dryRun, _ = cmd.Flags().GetBool("dry-run")
+		opts.planOut, _ = cmd.Flags().GetString("plan-out")
+		opts.inMemory, _ = cmd.Flags().GetBool("in-memory")
+		if ok, err := help.PathExists(opts.cfgPath); !ok || err != nil {
 			panic("Config file not found.")
 		}
-		start(excelPath, step, cfgPath)
+		start(opts)
 	},
 }
 
+type runOptions struct {
+	step     string
+	data     string
+	source   string
+	startRow int
+	cfgPath  string
+	dryRun   bool
+	planOut  string
+	inMemory bool
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().StringP("config", "c", "config.yml", "Config file path")
-	runCmd.Flags().StringP("data", "f", "excel/pan_all.xlsx", "Excel file path")
-	runCmd.Flags().StringP("type", "t", "1", "1. Download pan img | 2. Request ocr")
+	runCmd.Flags().StringP("data", "f", "excel/pan_all.xlsx", "Data file path (.xlsx, .csv, .jsonl, .sql) or SQL query with --source sql")
+	runCmd.Flags().String("source", "", "Data source: excel | csv | jsonl | sql, detected from the file extension by default")
+	runCmd.Flags().Int("start-row", 0, "Skip data before this row number (1-based, header included)")
+	runCmd.Flags().StringP("type", "t", "1", "1. Download pan img | 2. Request ocr | all. Download and request ocr row by row")
 	runCmd.Flags().BoolP("daemon", "d", false, "Daemon")
+	runCmd.Flags().Bool("dry-run", false, "Print the plan without touching S3, ADV or database writes")
+	runCmd.Flags().String("plan-out", "", "Export the dry-run plan as JSON to this path")
+	runCmd.Flags().Bool("in-memory", false, "With -t all, keep downloaded images in memory instead of writing them to disk")
 }
 
-func start(excelPath string, step string, cfgPath string) {
+func start(opts runOptions) {
+	step := opts.step
 
 	ctx, cancel := signalcontext.OnInterrupt()
 	defer cancel()
 
 	logger := logging.DefaultLogger()
-	config.InitConfigFile(cfgPath)
+	config.InitConfigFile(opts.cfgPath)
 	appConfig := config.App()
+	if err := loan.InitFieldCipher(); err != nil {
+		logger.Errorf("Init field cipher err: %s", err)
+		return
+	}
+
+	db := openDB(logger)
+	downloader := pugaws.NewS3Downloader()
+	httpClient, err := pughttp.New(appConfig.Pdl.HttpClient)
+	if err != nil {
+		panic(err)
+	}
+	advOcrClient := advance.NewAdvOcrClient("PAN_FRONT")
+	advOcrClient.SetHTTPClient(httpClient)
+	ocrProviders, err := ocr.NewSelectorFromConfig([]ocr.Provider{advOcrClient}, appConfig.Pdl.Ocr)
+	if err != nil {
+		panic(err)
+	}
+
+	svc := loan.NewService(loan.NewGormRepos(db), downloader, ocrProviders)
+	svc.SetHTTPClient(httpClient)
+
+	src, err := loan.OpenSource(db, opts.source, opts.data)
+	if err != nil {
+		logger.Errorf("Open source err: %s", err)
+		return
+	}
+	src.StartFrom(opts.startRow)
+
+	if opts.dryRun {
+		plan, err := svc.PlanOcr(src, step == "all")
+		if err != nil {
+			logger.Errorf("Plan err: %s", err)
+			return
+		}
+		plan.Print(os.Stdout)
+		if opts.planOut != "" {
+			if err := plan.Export(opts.planOut); err != nil {
+				logger.Errorf("Export plan err: %s", err)
+			}
+		}
+		return
+	}
+
+	if err := checkSchema(db); err != nil {
+		logger.Errorf("Check schema err: %s", err)
+		return
+	}
+
+	now := time.Now()
+	used, err := svc.CountOcrAttemptsSince(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		logger.Errorf("Count today's ocr attempts err: %s", err)
+		return
+	}
+	advOcrClient.SetDailyUsed(used)
+
+	var summary loan.Summary
+	switch step {
+	case "1":
+		summary = svc.BatchDownloadImg(ctx, src)
+	case "2":
+		summary = svc.BatchReqAdvIdCardOcr(ctx, src)
+	case "all":
+		summary = svc.BatchDownloadAndOcr(ctx, src, opts.inMemory)
+	default:
+		logger.Errorf("Unknown type %s", step)
+		return
+	}
+
+	logger.Infof("Summary: total %d, succeeded %d, failed %d, not started %d, elapsed %s",
+		summary.Total, summary.Succeeded, summary.Failed, summary.Skipped, summary.Elapsed)
+	if summary.Interrupted {
+		logger.Warn("Interrupted, run again to resume.")
+	}
+
+	logger.Info("Closed.")
+}
 
-	db, err := gorm.Open("mysql", appConfig.Mysql.Url)
+func openDB(logger *zap.SugaredLogger) *gorm.DB {
+	db, err := gorm.Open("mysql", config.App().Mysql.Url)
 	if err != nil {
 		fmt.Println(err)
 		panic("Failed to connect to the database, please check the configuration")
@@ -76,23 +181,10 @@ func start(excelPath string, step string, cfgPath string) {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	dbStats := sqlDB.Stats()
-	dbStatsContent, err := json.Marshal(dbStats)
+	dbStatsContent, _ := json.Marshal(dbStats)
 	logger.Infof("Mysql db pool: %s", string(dbStatsContent))
 
+	db.SetLogger(logging.NewGormLogger(logger))
 	db.LogMode(true)
-	downloader := pugaws.NewS3Downloader()
-	advOcrClient := advance.NewAdvOcrClient("PAN_FRONT")
-
-	loan.Init(db, downloader, advOcrClient)
-
-	switch step {
-	case "1":
-		loan.BatchDownloadImg(excelPath)
-	case "2":
-		loan.BatchReqAdvIdCardOcr(excelPath)
-	}
-
-	<-ctx.Done()
-
-	logger.Info("Closed.")
+	return db
 }
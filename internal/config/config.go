@@ -29,20 +29,109 @@ type AppConfig struct {
 		Port string `yaml:"port"`
 	} `yaml:"server"`
 
+	Security struct {
+		EncryptionKey string `yaml:"encryptionKey"` // 个人信息字段加密密钥，32 字节 base64 或 hex，环境变量 PDL_ENCRYPTION_KEY 优先
+	} `yaml:"security"`
+
 	Pdl struct {
 		BaseDir   string `yaml:"baseDir"`
 		ChunkSize int    `yaml:"chunkSize"`
 		AsyncSize int    `yaml:"asyncSize"`
+		Pipeline  struct {
+			QueueSize       int `yaml:"queueSize"`
+			DownloadWorkers int `yaml:"downloadWorkers"`
+			OcrWorkers      int `yaml:"ocrWorkers"`
+			PersistWorkers  int `yaml:"persistWorkers"`
+			DrainTimeout    int `yaml:"drainTimeout"` // 中断后等待处理中任务的秒数
+		} `yaml:"pipeline"`
 		AdvanceAI struct {
 			AdvanceAiKey string `yaml:"advanceAiKey"`
 			IdCardOcrUrl string `yaml:"idCardOcrUrl"`
+			Timeout      int    `yaml:"timeout"` // 单次调用超时秒数，默认 30
+			RateLimit    struct {
+				Qps          float64 `yaml:"qps"`          // 每秒请求数，0 不限速
+				Burst        int     `yaml:"burst"`        // 令牌桶容量
+				DailyCap     int     `yaml:"dailyCap"`     // 每日调用上限，0 不限制
+				PauseSeconds int     `yaml:"pauseSeconds"` // OVER_QUERY_LIMIT 后暂停秒数
+			} `yaml:"rateLimit"`
+			Retry RetryConfig `yaml:"retry"`
 		} `yaml:"advanceAI"`
+		Input       InputConfig      `yaml:"input"`
+		Ocr         OcrConfig        `yaml:"ocr"`
+		Preprocess  PreprocessConfig `yaml:"preprocess"`
+		Verify      VerifyConfig     `yaml:"verify"`
+		HttpClient  HttpClientConfig `yaml:"httpClient"`
 		EventServer struct {
-			ThirdUrl string `yaml:"thirdUrl"`
+			ThirdUrl      string      `yaml:"thirdUrl"`
+			BatchUrl      string      `yaml:"batchUrl"`      // 批量接口，配置后一批埋点以 JSON 数组一次发送
+			BatchSize     int         `yaml:"batchSize"`     // 每批发送条数，默认 50
+			FlushInterval int         `yaml:"flushInterval"` // 发送间隔秒数，默认 5
+			Retry         RetryConfig `yaml:"retry"`         // 使用 maxAttempts、initialBackoff、maxBackoff、multiplier
 		} `yaml:"eventServer"`
 	} `yaml:"pdl"`
 }
 
+// 输入数据的列映射与校验规则
+type InputConfig struct {
+	Columns       map[string][]string `yaml:"columns"`       // 字段 -> 表头别名，字段为 custNo/busiType/inPath/appNo/phoneNo
+	BusiTypes     []string            `yaml:"busiTypes"`     // 允许的业务类型，为空时使用 ocr 中配置的业务类型
+	CustNoPattern string              `yaml:"custNoPattern"` // 客户编号正则
+	PhonePattern  string              `yaml:"phonePattern"`  // 手机号正则
+}
+
+// OCR 服务商与证件类型配置
+type OcrConfig struct {
+	DefaultProvider string            `yaml:"defaultProvider"`
+	Providers       map[string]string `yaml:"providers"` // busiType -> 服务商名称
+	DefaultCardType string            `yaml:"defaultCardType"`
+	CardTypes       map[string]string `yaml:"cardTypes"` // busiType -> 证件类型
+}
+
+// 识别前的图片预处理配置，未配置的项使用默认值
+type PreprocessConfig struct {
+	Enabled      bool `yaml:"enabled"`
+	Workers      int  `yaml:"workers"`      // 并发数，默认 CPU 核数
+	MaxDimension int  `yaml:"maxDimension"` // 长边最大像素，超过时缩小
+	MaxBytes     int  `yaml:"maxBytes"`     // 上传图片最大字节数，超过时降低质量或继续缩小
+	MinDimension int  `yaml:"minDimension"` // 短边最小像素，小于时拒绝
+	MinBytes     int  `yaml:"minBytes"`     // 最小字节数，小于时拒绝
+	Quality      int  `yaml:"quality"`      // JPEG 质量 1~100
+}
+
+// 识别结果校验配置
+type VerifyConfig struct {
+	NameThreshold float64 `yaml:"nameThreshold"` // 识别姓名与已有客户姓名的最低相似度 0~1，默认 0.75
+}
+
+// 对外调用共用的 HTTP 客户端配置，未配置的项使用默认值
+type HttpClientConfig struct {
+	Timeout             int    `yaml:"timeout"`             // 整个请求的超时秒数
+	ConnectTimeout      int    `yaml:"connectTimeout"`      // 建立连接超时秒数
+	ReadTimeout         int    `yaml:"readTimeout"`         // 发送请求后等待响应头的超时秒数
+	KeepAlive           int    `yaml:"keepAlive"`           // TCP keep-alive 间隔秒数
+	MaxIdleConns        int    `yaml:"maxIdleConns"`        // 空闲连接池大小
+	MaxIdleConnsPerHost int    `yaml:"maxIdleConnsPerHost"` // 每个主机的空闲连接数
+	IdleConnTimeout     int    `yaml:"idleConnTimeout"`     // 空闲连接保留秒数
+	Proxy               string `yaml:"proxy"`               // 代理地址，为空时读取 HTTP_PROXY 等环境变量
+	Tls                 struct {
+		MinVersion         string `yaml:"minVersion"` // 1.0/1.1/1.2/1.3，默认 1.2
+		CaFile             string `yaml:"caFile"`     // 额外信任的 CA 证书
+		InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	} `yaml:"tls"`
+}
+
+// 重试策略配置
+type RetryConfig struct {
+	MaxAttempts     int      `yaml:"maxAttempts"`
+	InitialBackoff  int      `yaml:"initialBackoff"` // 毫秒
+	MaxBackoff      int      `yaml:"maxBackoff"`     // 毫秒
+	Multiplier      float64  `yaml:"multiplier"`
+	Jitter          float64  `yaml:"jitter"` // 0~1
+	RetryableCodes  []string `yaml:"retryableCodes"`
+	TerminalCodes   []string `yaml:"terminalCodes"`
+	RetryableStatus []int    `yaml:"retryableStatus"`
+}
+
 var (
 	instance *AppConfig
 	once     sync.Once
@@ -2,17 +2,33 @@ package advance
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
 	"github.com/onlythinking/pug-go/pkg/help"
+	"github.com/onlythinking/pug-go/pkg/pugerr"
 
 	log "github.com/onlythinking/pug-go/pkg/logging"
+	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"time"
 )
 
+// 服务商名称
+const ProviderName = "advance"
+
+// 收费标识
+const PAY = "PAY"
+
+// 单次调用默认超时时长
+const defaultTimeout = 30 * time.Second
+
 const (
 	// SUCCESS
 
@@ -61,125 +77,327 @@ type AdvResp struct {
 	PricingStrategy string      `json:"pricingStrategy"`
 }
 
+// values 随证件类型不同，见 card.go
 type AdvRespData struct {
-	CardType string           `json:"cardType"`
-	Values   AdvRespDataValue `json:"values"`
-}
-
-type AdvRespDataValue struct {
-	IdNumber   string `json:"idNumber"`
-	Name       string `json:"name"`
-	Birthday   string `json:"birthday"`
-	FatherName string `json:"fatherName"`
+	CardType string          `json:"cardType"`
+	Values   json.RawMessage `json:"values"`
 }
 
 type AdvClient struct {
 	advUrl  string
 	headers map[string]string
 	params  map[string]string
+	limiter *Limiter
+	retry   *RetryPolicy
+	timeout time.Duration
+	client  *http.Client
 }
 
-// PAN_FRONT
+// cardType 为请求未指定证件类型时的默认值，如 PAN_FRONT
 func NewAdvOcrClient(cardType string) *AdvClient {
 	cfg := config.App()
-	advClient := AdvClient{}
-	advClient.advUrl = cfg.Pdl.AdvanceAI.IdCardOcrUrl
-	advClient.headers = map[string]string{"X-ADVAI-KEY": cfg.Pdl.AdvanceAI.AdvanceAiKey}
-	advClient.params = map[string]string{"cardType": cardType}
-	return &advClient
-}
 
-func (ths *AdvClient) ReqIdCardOcr(filename string) ([]byte, error) {
-	count := 0
+	rateLimit := cfg.Pdl.AdvanceAI.RateLimit
+	pause := time.Duration(rateLimit.PauseSeconds) * time.Second
+	if pause <= 0 {
+		pause = time.Minute
+	}
+	limiter := NewLimiter(rateLimit.Qps, rateLimit.Burst, rateLimit.DailyCap, pause)
+	retry := NewRetryPolicy(cfg.Pdl.AdvanceAI.Retry)
 
-	exist, err := help.PathExists(filename)
-	if !exist || err != nil {
-		return nil, err
+	client := NewAdvClient(cfg.Pdl.AdvanceAI.IdCardOcrUrl, cfg.Pdl.AdvanceAI.AdvanceAiKey, cardType, limiter, retry)
+	if cfg.Pdl.AdvanceAI.Timeout > 0 {
+		client.SetTimeout(time.Duration(cfg.Pdl.AdvanceAI.Timeout) * time.Second)
 	}
+	return client
+}
 
-	data, err := ths.DoReqIdCardOcr(filename, count)
+// 指定地址、密钥和策略创建客户端
+func NewAdvClient(advUrl string, advKey string, cardType string, limiter *Limiter, retry *RetryPolicy) *AdvClient {
+	return &AdvClient{
+		advUrl:  advUrl,
+		headers: map[string]string{"X-ADVAI-KEY": advKey},
+		params:  map[string]string{"cardType": cardType},
+		limiter: limiter,
+		retry:   retry,
+		timeout: defaultTimeout,
+		client:  http.DefaultClient,
+	}
+}
+
+func (ths *AdvClient) ReqIdCardOcr(ctx context.Context, filename string, cardType string) ([]byte, []ocr.Attempt, error) {
+	image, err := fileImage(filename)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return ths.reqOcr(ctx, image, cardType)
+}
+
+// 识别内存中的图片，name 为上传的文件名
+func (ths *AdvClient) ReqImageOcr(ctx context.Context, name string, image []byte, cardType string) ([]byte, []ocr.Attempt, error) {
+	return ths.reqOcr(ctx, bytesImage(name, image), cardType)
+}
+
+func (ths *AdvClient) reqOcr(ctx context.Context, image uploadImage, cardType string) ([]byte, []ocr.Attempt, error) {
+	var attempts []ocr.Attempt
+	for reqCount := 1; ; reqCount++ {
+		data, attempt, err := ths.doReqIdCardOcr(ctx, image, cardType, reqCount)
+		attempts = append(attempts, attempt)
+		if !ths.retry.ShouldRetry(attempt, err) {
+			return data, attempts, err
+		}
+
+		backoff := ths.retry.Backoff(reqCount)
+		log.Warnf("ADV_ retry %s after %s, code: %s err: %v", image.name, backoff, attempt.Code, err)
+		// OVER_QUERY_LIMIT 重试前还会在限流器中等待暂停结束
+		if err := sleep(ctx, backoff); err != nil {
+			return data, attempts, err
+		}
+	}
+}
 
-	return data, nil
+// 单次调用超时时长，超时的调用可能已计费，不重试
+func (ths *AdvClient) SetTimeout(timeout time.Duration) {
+	ths.timeout = timeout
 }
 
-func (ths *AdvClient) DoReqIdCardOcr(filename string, reqCount int) ([]byte, error) {
-	reqCount++
-	request, err := newFileUploadRequest(ths.advUrl, ths.headers, ths.params, "image", filename)
+// 发送请求使用的客户端，通常为 pughttp.New 创建的共享客户端
+func (ths *AdvClient) SetHTTPClient(client *http.Client) {
+	ths.client = client
+}
+
+// 恢复当日已调用次数，多次启动时每日上限仍按全天计算
+func (ths *AdvClient) SetDailyUsed(used int) {
+	ths.limiter.SetUsed(used)
+}
+
+// 执行单次调用
+func (ths *AdvClient) doReqIdCardOcr(ctx context.Context, image uploadImage, cardType string, reqCount int) ([]byte, ocr.Attempt, error) {
+	attempt := ocr.Attempt{No: reqCount}
+	if err := ths.limiter.Wait(ctx); err != nil {
+		attempt.Err = err.Error()
+		return nil, attempt, err
+	}
+
+	params := ths.params
+	if cardType != "" {
+		params = map[string]string{"cardType": cardType}
+	}
+
+	if ths.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ths.timeout)
+		defer cancel()
+	}
+	request, err := newImageUploadRequest(ctx, ths.advUrl, ths.headers, params, "image", image)
 	if err != nil {
-		return nil, err
+		attempt.Err = err.Error()
+		return nil, attempt, err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(request)
+	attempt.RequestTime = time.Now()
+	resp, err := ths.client.Do(request)
+	attempt.ResponseTime = time.Now()
 	if err != nil {
-		return nil, err
+		attempt.Err = err.Error()
+		return nil, attempt, err
 	}
 
 	defer resp.Body.Close()
-	respBody, _ := ioutil.ReadAll(resp.Body)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	attempt.HttpStatus = resp.StatusCode
+	if err != nil {
+		attempt.Err = err.Error()
+		return nil, attempt, err
+	}
 
 	if resp.StatusCode != 200 {
 		log.Errorf("ADV_ HTTP status：%s %s", resp.Status, string(respBody))
-		return nil, err
+		err = &StatusError{Status: resp.StatusCode, Body: string(respBody)}
+		attempt.Err = err.Error()
+		return nil, attempt, err
 	}
 
 	adResp := AdvResp{}
 	err = json.Unmarshal(respBody, &adResp)
 
 	if err != nil {
-		return nil, err
+		attempt.Err = err.Error()
+		return nil, attempt, err
 	}
 
-	if SUCCESS != adResp.Code {
-		if SERVICE_BUSY == adResp.Code && reqCount < 3 {
-			return ths.DoReqIdCardOcr(filename, reqCount)
+	attempt.Code = adResp.Code
+	attempt.TransactionId = adResp.TransactionId
+	attempt.Paid = PAY == adResp.PricingStrategy
+
+	ths.limiter.Observe(adResp.Code)
+
+	return respBody, attempt, nil
+}
+
+func (ths *AdvClient) Name() string {
+	return ProviderName
+}
+
+// 实现 ocr.Provider
+func (ths *AdvClient) Recognize(ctx context.Context, filename string, cardType string) (*ocr.Result, error) {
+	data, attempts, err := ths.ReqIdCardOcr(ctx, filename, cardType)
+	return ths.toResult(data, attempts, cardType, err)
+}
+
+// 实现 ocr.ImageRecognizer
+func (ths *AdvClient) RecognizeImage(ctx context.Context, name string, image []byte, cardType string) (*ocr.Result, error) {
+	data, attempts, err := ths.ReqImageOcr(ctx, name, image, cardType)
+	return ths.toResult(data, attempts, cardType, err)
+}
+
+func (ths *AdvClient) toResult(data []byte, attempts []ocr.Attempt, cardType string, err error) (*ocr.Result, error) {
+	result := &ocr.Result{Provider: ProviderName, Raw: data, Attempts: attempts}
+	if err != nil {
+		return result, err
+	}
+
+	advResp := AdvResp{}
+	if err := json.Unmarshal(data, &advResp); err != nil {
+		return result, err
+	}
+
+	result.Code = advResp.Code
+	result.Message = advResp.Message
+	result.Success = SUCCESS == advResp.Code
+	result.Terminal = ths.retry.IsTerminal(advResp.Code)
+	result.Exhausted = INSUFFICIENT_BALANCE == advResp.Code
+	result.Paid = PAY == advResp.PricingStrategy
+	result.TransactionId = advResp.TransactionId
+	result.CardType = advResp.Data.CardType
+	if result.CardType == "" {
+		result.CardType = cardType
+	}
+
+	value, err := decodeCardValue(result.CardType, advResp.Data.Values)
+	if err != nil {
+		// 已识别成功或已收费时不再重试，字段留空由校验转人工复核，原始响应见 Raw
+		if result.Success || result.Paid {
+			log.Errorf("ADV_ decode %s values of %s err: %s", result.CardType, result.TransactionId, err)
+			return result, nil
 		}
+		return result, err
 	}
+	result.Fields = value.Fields()
+	return result, nil
+}
 
-	return respBody, nil
+// 上传的图片，每次调用重新打开，size 未知时为 -1
+type uploadImage struct {
+	name string
+	size int64
+	open func() (io.ReadCloser, error)
 }
 
-func newFileUploadRequest(uri string, headers map[string]string, params map[string]string, paramName, path string) (*http.Request, error) {
-	file, err := os.Open(path)
+// 本地图片，上传时再读取
+func fileImage(filename string) (uploadImage, error) {
+	exist, err := help.PathExists(filename)
 	if err != nil {
-		return nil, err
+		return uploadImage{}, err
 	}
-	fileContents, err := ioutil.ReadAll(file)
-	if err != nil {
-		return nil, err
+	if !exist {
+		return uploadImage{}, pugerr.ViolationError(filename + " not found .")
 	}
-	fi, err := file.Stat()
+	fi, err := os.Stat(filename)
 	if err != nil {
-		return nil, err
+		return uploadImage{}, err
 	}
-	file.Close()
+	return uploadImage{
+		name: filepath.Base(filename),
+		size: fi.Size(),
+		open: func() (io.ReadCloser, error) { return os.Open(filename) },
+	}, nil
+}
 
-	body := new(bytes.Buffer)
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile(paramName, fi.Name())
-	if err != nil {
-		return nil, err
+func bytesImage(name string, image []byte) uploadImage {
+	return uploadImage{
+		name: name,
+		size: int64(len(image)),
+		open: func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(image)), nil },
 	}
-	part.Write(fileContents)
+}
 
-	for key, val := range params {
-		_ = writer.WriteField(key, val)
+// 流式构造 multipart 请求体，图片边读边写，不整体加载到内存
+// 图片大小已知时设置 Content-Length，否则使用分块传输
+// 返回的请求须交给 http.Client 发送，Client 会关闭请求体并结束写入协程
+func newImageUploadRequest(ctx context.Context, uri string, headers map[string]string, params map[string]string, paramName string, image uploadImage) (*http.Request, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
 
-	err = writer.Close()
+	contentLength := int64(-1)
+	if image.size >= 0 {
+		overhead, err := multipartOverhead(writer.Boundary(), paramName, image.name, params, keys)
+		if err != nil {
+			return nil, err
+		}
+		contentLength = overhead + image.size
+	}
+
+	file, err := image.open()
 	if err != nil {
 		return nil, err
 	}
-
-	request, _ := http.NewRequest("POST", uri, body)
-
+	request, err := http.NewRequestWithContext(ctx, "POST", uri, pr)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	request.ContentLength = contentLength
 	for key, val := range headers {
 		request.Header.Add(key, val)
 	}
-
 	request.Header.Add("Content-Type", writer.FormDataContentType())
-	return request, err
+
+	go func() {
+		defer file.Close()
+		pw.CloseWithError(writeMultipart(writer, paramName, image.name, file, params, keys))
+	}()
+	return request, nil
+}
+
+func writeMultipart(writer *multipart.Writer, paramName string, name string, file io.Reader, params map[string]string, keys []string) error {
+	part, err := writer.CreateFormFile(paramName, name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := writer.WriteField(key, params[key]); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// 除图片内容外的请求体长度
+func multipartOverhead(boundary string, paramName string, name string, params map[string]string, keys []string) (int64, error) {
+	var counter byteCounter
+	writer := multipart.NewWriter(&counter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return 0, err
+	}
+	if err := writeMultipart(writer, paramName, name, bytes.NewReader(nil), params, keys); err != nil {
+		return 0, err
+	}
+	return int64(counter), nil
+}
+
+type byteCounter int64
+
+func (ths *byteCounter) Write(p []byte) (int, error) {
+	*ths += byteCounter(len(p))
+	return len(p), nil
 }
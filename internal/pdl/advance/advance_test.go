@@ -0,0 +1,311 @@
+package advance_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/advance"
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	"github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 日志写入临时目录
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "advance-test")
+	if err != nil {
+		panic(err)
+	}
+	logging.SetLogFile(filepath.Join(dir, "app.log"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newClient(t *testing.T, server *advancetest.Server) *advance.AdvClient {
+	t.Helper()
+	retry := advance.NewRetryPolicy(config.RetryConfig{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 5})
+	limiter := advance.NewLimiter(0, 1, 0, 10*time.Millisecond)
+	return advance.NewAdvClient(server.URL, "test-key", ocr.PanFront, limiter, retry)
+}
+
+func writeImage(t *testing.T, name string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte("fake image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestRecognizeSuccess(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.Enqueue(advancetest.Success(map[string]string{
+		"idNumber": "ABCDE1234F", "name": "RAVI KUMAR", "birthday": "01/02/1990", "fatherName": "RAM KUMAR",
+	}))
+
+	result, err := newClient(t, server).Recognize(context.Background(), writeImage(t, "pan.jpg"), ocr.PanFront)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || !result.Paid || result.TransactionId == "" {
+		t.Errorf("unexpected result %#v", result)
+	}
+	want := ocr.CardFields{IdNumber: "ABCDE1234F", Name: "RAVI KUMAR", Birthday: "01/02/1990", FatherName: "RAM KUMAR"}
+	if result.Fields.IdNumber != want.IdNumber || result.Fields.Name != want.Name ||
+		result.Fields.Birthday != want.Birthday || result.Fields.FatherName != want.FatherName {
+		t.Errorf("expected %#v to be %#v", result.Fields, want)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0].Key != "test-key" || requests[0].CardType != ocr.PanFront || requests[0].Filename != "pan.jpg" {
+		t.Errorf("unexpected request %#v", requests[0])
+	}
+}
+
+func TestRecognizeImage(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.Script("mem.jpg", advancetest.Code(advance.SERVICE_BUSY), advancetest.Success(map[string]string{"idNumber": "ABCDE1234F"}))
+
+	result, err := newClient(t, server).RecognizeImage(context.Background(), "mem.jpg", []byte("fake image"), ocr.PanFront)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Fields.IdNumber != "ABCDE1234F" || len(result.Attempts) != 2 {
+		t.Errorf("unexpected result %#v", result)
+	}
+	if got := server.Count("mem.jpg"); got != 2 {
+		t.Errorf("expected 2 requests, got %d", got)
+	}
+}
+
+func TestRecognizeCardType(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.Enqueue(advancetest.Success(map[string]string{"idNumber": "1234 5678 9012", "address": "MUMBAI", "pin": "400001"}))
+
+	result, err := newClient(t, server).Recognize(context.Background(), writeImage(t, "back.jpg"), ocr.AadhaarBack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CardType != ocr.AadhaarBack || result.Fields.Address != "MUMBAI" || result.Fields.Extra["pin"] != "400001" {
+		t.Errorf("unexpected result %#v", result)
+	}
+	if got := server.Requests()[0].CardType; got != ocr.AadhaarBack {
+		t.Errorf("expected card type %s, got %s", ocr.AadhaarBack, got)
+	}
+}
+
+func TestRecognizeRetry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		responses []advancetest.Response
+		requests  int
+		success   bool
+		wantErr   bool
+	}{
+		{"service busy", []advancetest.Response{advancetest.Code(advance.SERVICE_BUSY), advancetest.Success(nil)}, 2, true, false},
+		{"over query limit", []advancetest.Response{advancetest.Code(advance.OVER_QUERY_LIMIT), advancetest.Success(nil)}, 2, true, false},
+		{"server error", []advancetest.Response{advancetest.Status(503), advancetest.Success(nil)}, 2, true, false},
+		{"gives up", []advancetest.Response{advancetest.Status(500), advancetest.Status(500), advancetest.Status(500), advancetest.Success(nil)}, 3, false, true},
+		{"bad request", []advancetest.Response{advancetest.Status(400)}, 1, false, true},
+		{"terminal code", []advancetest.Response{advancetest.Code(advance.NO_SUPPORTED_CARD)}, 1, false, false},
+		{"malformed", []advancetest.Response{advancetest.Malformed()}, 1, false, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := advancetest.NewServer()
+			defer server.Close()
+			server.Enqueue(tc.responses...)
+
+			result, err := newClient(t, server).Recognize(context.Background(), writeImage(t, "pan.jpg"), ocr.PanFront)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if got := len(server.Requests()); got != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, got)
+			}
+			if got := len(result.Attempts); got != tc.requests {
+				t.Errorf("expected %d attempts, got %d", tc.requests, got)
+			}
+			if err == nil && result.Success != tc.success {
+				t.Errorf("expected success %t, got %#v", tc.success, result)
+			}
+		})
+	}
+}
+
+func TestRecognizeTerminal(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.Enqueue(advancetest.Code(advance.NO_SUPPORTED_CARD))
+
+	result, err := newClient(t, server).Recognize(context.Background(), writeImage(t, "pan.jpg"), ocr.PanFront)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || !result.Terminal || !result.Paid {
+		t.Errorf("unexpected result %#v", result)
+	}
+}
+
+func TestRecognizeUndecodableValues(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	// 已收费的成功响应字段类型不符时不重试
+	body := `{"code":"SUCCESS","message":"OK","transactionId":"tx-1","pricingStrategy":"PAY",` +
+		`"data":{"cardType":"PAN_FRONT","values":{"idNumber":1234}}}`
+	server.Enqueue(advancetest.Response{Body: body})
+
+	result, err := newClient(t, server).Recognize(context.Background(), writeImage(t, "pan.jpg"), ocr.PanFront)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || !result.Paid || result.Fields.IdNumber != "" || string(result.Raw) != body {
+		t.Errorf("unexpected result %#v", result)
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestRecognizeSlowResponse(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.SetDefault(advancetest.Success(nil).Slow(time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := newClient(t, server).Recognize(ctx, writeImage(t, "pan.jpg"), ocr.PanFront)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
+
+func TestRecognizeRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.SetDefault(advancetest.Success(nil).Slow(time.Second))
+
+	client := newClient(t, server)
+	client.SetTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := client.Recognize(context.Background(), writeImage(t, "pan.jpg"), ocr.PanFront)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected timeout before response, took %s", elapsed)
+	}
+	// 超时的调用可能已计费，不重试
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
+
+func TestRecognizeStreamingUpload(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "large.jpg")
+	image := make([]byte, 3<<20)
+	for i := range image {
+		image[i] = byte(i)
+	}
+	if err := ioutil.WriteFile(filename, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newClient(t, server)
+	if _, err := client.Recognize(context.Background(), filename, ocr.PanFront); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RecognizeImage(context.Background(), "mem.jpg", image, ocr.PanFront); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range server.Requests() {
+		if r.Size != int64(len(image)) || r.ContentLength <= r.Size || r.CardType != ocr.PanFront {
+			t.Errorf("unexpected request %#v", r)
+		}
+	}
+}
+
+func TestRecognizeInsufficientBalance(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	server.Enqueue(advancetest.Code(advance.INSUFFICIENT_BALANCE))
+
+	client := newClient(t, server)
+	filename := writeImage(t, "pan.jpg")
+
+	result, err := client.Recognize(context.Background(), filename, ocr.PanFront)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Exhausted {
+		t.Errorf("expected exhausted, got %#v", result)
+	}
+
+	_, err = client.Recognize(context.Background(), filename, ocr.PanFront)
+	if !ocr.IsQuotaExhausted(err) {
+		t.Fatalf("expected quota exhausted, got %v", err)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
+
+func TestRecognizeMissingFile(t *testing.T) {
+	t.Parallel()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+
+	_, err := newClient(t, server).Recognize(context.Background(), filepath.Join(t.TempDir(), "missing.jpg"), ocr.PanFront)
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if got := len(server.Requests()); got != 0 {
+		t.Errorf("expected no request, got %d", got)
+	}
+}
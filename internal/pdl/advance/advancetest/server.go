@@ -0,0 +1,216 @@
+// advancetest 提供 ADVANCE.AI 证件 OCR 接口的本地模拟服务，用于离线测试
+package advancetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// 收费的返回码
+var payCodes = map[string]bool{
+	"SUCCESS":             true,
+	"CARD_TYPE_NOT_MATCH": true,
+	"NO_SUPPORTED_CARD":   true,
+	"TOO_MANY_CARDS":      true,
+	"OCR_NO_RESULT":       true,
+}
+
+// 模拟响应
+type Response struct {
+	Status int    // HTTP 状态码，默认 200
+	Body   string // 原始响应体，不为空时忽略 Code 等字段
+	Code   string
+	Values map[string]string
+	Delay  time.Duration
+}
+
+// 识别成功
+func Success(values map[string]string) Response {
+	return Response{Code: "SUCCESS", Values: values}
+}
+
+// 指定返回码，如 SERVICE_BUSY、OVER_QUERY_LIMIT
+func Code(code string) Response {
+	return Response{Code: code}
+}
+
+// 非法 JSON
+func Malformed() Response {
+	return Response{Body: `{"code": "SUCCESS", "data": `}
+}
+
+// 指定 HTTP 状态码
+func Status(status int) Response {
+	return Response{Status: status, Body: http.StatusText(status)}
+}
+
+// 延迟响应
+func (ths Response) Slow(delay time.Duration) Response {
+	ths.Delay = delay
+	return ths
+}
+
+// 收到的请求
+type Request struct {
+	Key      string
+	CardType string
+	Filename string
+	Size     int64
+	// 请求头中的 Content-Length，分块传输时为 -1
+	ContentLength int64
+}
+
+// 模拟服务。响应优先按上传文件名的脚本返回，其次按全局脚本，最后返回默认响应
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	byFile   map[string][]Response
+	script   []Response
+	fallback Response
+	requests []Request
+	txSeq    int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		byFile:   map[string][]Response{},
+		fallback: Success(map[string]string{"idNumber": "ABCDE1234F", "name": "TEST NAME"}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// 追加全局脚本
+func (ths *Server) Enqueue(responses ...Response) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	ths.script = append(ths.script, responses...)
+}
+
+// 追加指定文件名（不含目录）的脚本
+func (ths *Server) Script(filename string, responses ...Response) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	ths.byFile[filename] = append(ths.byFile[filename], responses...)
+}
+
+// 脚本用完后的默认响应
+func (ths *Server) SetDefault(response Response) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	ths.fallback = response
+}
+
+// 已收到的请求
+func (ths *Server) Requests() []Request {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	return append([]Request(nil), ths.requests...)
+}
+
+// 指定文件收到的请求数
+func (ths *Server) Count(filename string) int {
+	n := 0
+	for _, r := range ths.Requests() {
+		if r.Filename == filename {
+			n++
+		}
+	}
+	return n
+}
+
+func (ths *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file.Close()
+
+	req := Request{
+		Key:           r.Header.Get("X-ADVAI-KEY"),
+		CardType:      r.FormValue("cardType"),
+		Filename:      header.Filename,
+		Size:          header.Size,
+		ContentLength: r.ContentLength,
+	}
+	response, txId := ths.next(req)
+
+	if response.Delay > 0 {
+		select {
+		case <-time.After(response.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := response.Body
+	if body == "" {
+		body = ths.render(response, req, txId)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+func (ths *Server) next(req Request) (Response, string) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.requests = append(ths.requests, req)
+	ths.txSeq++
+	txId := fmt.Sprintf("tx-%d", ths.txSeq)
+
+	if queue := ths.byFile[req.Filename]; len(queue) > 0 {
+		ths.byFile[req.Filename] = queue[1:]
+		return queue[0], txId
+	}
+	if len(ths.script) > 0 {
+		response := ths.script[0]
+		ths.script = ths.script[1:]
+		return response, txId
+	}
+	return ths.fallback, txId
+}
+
+func (ths *Server) render(response Response, req Request, txId string) string {
+	pricing := "FREE"
+	if payCodes[response.Code] {
+		pricing = "PAY"
+	}
+
+	values := response.Values
+	if values == nil {
+		values = map[string]string{}
+	}
+	body := map[string]interface{}{
+		"code":    response.Code,
+		"message": response.Code,
+		"data": map[string]interface{}{
+			"cardType": req.CardType,
+			"values":   values,
+		},
+		"extra":           "",
+		"transactionId":   txId,
+		"pricingStrategy": pricing,
+	}
+	if response.Code != "SUCCESS" {
+		body["data"] = nil
+	}
+	data, _ := json.Marshal(body)
+	return string(data)
+}
@@ -0,0 +1,164 @@
+package advance
+
+import (
+	"encoding/json"
+
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+)
+
+// 各证件类型的识别字段
+
+// PAN_FRONT
+type AdvRespDataValue struct {
+	IdNumber   string `json:"idNumber"`
+	Name       string `json:"name"`
+	Birthday   string `json:"birthday"`
+	FatherName string `json:"fatherName"`
+}
+
+// AADHAAR_FRONT
+type AadhaarFrontValue struct {
+	IdNumber   string `json:"idNumber"`
+	Name       string `json:"name"`
+	Birthday   string `json:"birthday"`
+	Gender     string `json:"gender"`
+	FatherName string `json:"fatherName"`
+}
+
+// AADHAAR_BACK
+type AadhaarBackValue struct {
+	IdNumber string `json:"idNumber"`
+	Address  string `json:"address"`
+	Pin      string `json:"pin"`
+}
+
+// VOTER_FRONT
+type VoterFrontValue struct {
+	IdNumber     string `json:"idNumber"`
+	Name         string `json:"name"`
+	RelationName string `json:"relationName"`
+	RelationType string `json:"relationType"`
+	Gender       string `json:"gender"`
+	Birthday     string `json:"birthday"`
+}
+
+// VOTER_BACK
+type VoterBackValue struct {
+	IdNumber  string `json:"idNumber"`
+	Address   string `json:"address"`
+	Birthday  string `json:"birthday"`
+	Gender    string `json:"gender"`
+	IssueDate string `json:"issueDate"`
+}
+
+// DRIVING_LICENSE_FRONT
+type DrivingLicenceValue struct {
+	IdNumber   string `json:"idNumber"`
+	Name       string `json:"name"`
+	Birthday   string `json:"birthday"`
+	FatherName string `json:"fatherName"`
+	Address    string `json:"address"`
+	IssueDate  string `json:"issueDate"`
+	ExpiryDate string `json:"expiryDate"`
+}
+
+// PASSPORT_FRONT
+type PassportFrontValue struct {
+	IdNumber     string `json:"idNumber"`
+	Name         string `json:"name"`
+	Surname      string `json:"surname"`
+	GivenName    string `json:"givenName"`
+	Birthday     string `json:"birthday"`
+	Gender       string `json:"gender"`
+	Nationality  string `json:"nationality"`
+	PlaceOfBirth string `json:"placeOfBirth"`
+	PlaceOfIssue string `json:"placeOfIssue"`
+	IssueDate    string `json:"issueDate"`
+	ExpiryDate   string `json:"expiryDate"`
+}
+
+// 转换为归一化字段
+type CardValue interface {
+	Fields() ocr.CardFields
+}
+
+func (ths AdvRespDataValue) Fields() ocr.CardFields {
+	return ocr.CardFields{IdNumber: ths.IdNumber, Name: ths.Name, Birthday: ths.Birthday, FatherName: ths.FatherName}
+}
+
+func (ths AadhaarFrontValue) Fields() ocr.CardFields {
+	return ocr.CardFields{IdNumber: ths.IdNumber, Name: ths.Name, Birthday: ths.Birthday, FatherName: ths.FatherName, Gender: ths.Gender}
+}
+
+func (ths AadhaarBackValue) Fields() ocr.CardFields {
+	return ocr.CardFields{IdNumber: ths.IdNumber, Address: ths.Address, Extra: extra("pin", ths.Pin)}
+}
+
+func (ths VoterFrontValue) Fields() ocr.CardFields {
+	fields := ocr.CardFields{IdNumber: ths.IdNumber, Name: ths.Name, Birthday: ths.Birthday, Gender: ths.Gender,
+		Extra: extra("relationName", ths.RelationName, "relationType", ths.RelationType)}
+	if ths.RelationType == "" || ths.RelationType == "FATHER" {
+		fields.FatherName = ths.RelationName
+	}
+	return fields
+}
+
+func (ths VoterBackValue) Fields() ocr.CardFields {
+	return ocr.CardFields{IdNumber: ths.IdNumber, Address: ths.Address, Birthday: ths.Birthday, Gender: ths.Gender,
+		Extra: extra("issueDate", ths.IssueDate)}
+}
+
+func (ths DrivingLicenceValue) Fields() ocr.CardFields {
+	return ocr.CardFields{IdNumber: ths.IdNumber, Name: ths.Name, Birthday: ths.Birthday, FatherName: ths.FatherName,
+		Address: ths.Address, Extra: extra("issueDate", ths.IssueDate, "expiryDate", ths.ExpiryDate)}
+}
+
+func (ths PassportFrontValue) Fields() ocr.CardFields {
+	return ocr.CardFields{IdNumber: ths.IdNumber, Name: ths.Name, Birthday: ths.Birthday, Gender: ths.Gender,
+		Extra: extra("surname", ths.Surname, "givenName", ths.GivenName, "nationality", ths.Nationality,
+			"placeOfBirth", ths.PlaceOfBirth, "placeOfIssue", ths.PlaceOfIssue,
+			"issueDate", ths.IssueDate, "expiryDate", ths.ExpiryDate)}
+}
+
+// 按证件类型解析 values，未知类型按 PAN 字段解析
+func decodeCardValue(cardType string, data json.RawMessage) (CardValue, error) {
+	var value CardValue
+	switch cardType {
+	case ocr.AadhaarFront:
+		value = &AadhaarFrontValue{}
+	case ocr.AadhaarBack:
+		value = &AadhaarBackValue{}
+	case ocr.VoterFront:
+		value = &VoterFrontValue{}
+	case ocr.VoterBack:
+		value = &VoterBackValue{}
+	case ocr.DrivingLicenceFront:
+		value = &DrivingLicenceValue{}
+	case ocr.PassportFront:
+		value = &PassportFrontValue{}
+	default:
+		value = &AdvRespDataValue{}
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return value, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// 忽略空值的键值对
+func extra(kv ...string) map[string]string {
+	var m map[string]string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		if m == nil {
+			m = map[string]string{}
+		}
+		m[kv[i]] = kv[i+1]
+	}
+	return m
+}
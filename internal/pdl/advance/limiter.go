@@ -0,0 +1,134 @@
+package advance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// 账户余额不足，整个批次应停止
+	ErrInsufficientBalance = fmt.Errorf("advance: insufficient balance: %w", ocr.ErrQuotaExhausted)
+	// 达到每日调用上限
+	ErrDailyCapReached = fmt.Errorf("advance: daily cap reached: %w", ocr.ErrQuotaExhausted)
+)
+
+// 客户端限流器：令牌桶控制 QPS，每日调用上限，
+// OVER_QUERY_LIMIT 时全局暂停，INSUFFICIENT_BALANCE 时终止
+type Limiter struct {
+	limiter  *rate.Limiter
+	dailyCap int
+	pause    time.Duration
+
+	mu          sync.Mutex
+	day         string
+	used        int
+	pausedUntil time.Time
+	aborted     error
+}
+
+// qps <= 0 时不限速，dailyCap <= 0 时不限制每日调用数
+// 每日计数在进程内累加，启动时用 SetUsed 恢复当日已调用次数
+func NewLimiter(qps float64, burst int, dailyCap int, pause time.Duration) *Limiter {
+	limit := rate.Inf
+	if qps > 0 {
+		limit = rate.Limit(qps)
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &Limiter{
+		limiter:  rate.NewLimiter(limit, burst),
+		dailyCap: dailyCap,
+		pause:    pause,
+	}
+}
+
+// 设置当日已调用次数，如从调用明细统计的当日请求数
+func (ths *Limiter) SetUsed(used int) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.day = time.Now().Format("2006-01-02")
+	ths.used = used
+}
+
+// 阻塞直到允许发出下一次请求
+func (ths *Limiter) Wait(ctx context.Context) error {
+	if err := ths.waitPause(ctx); err != nil {
+		return err
+	}
+	if err := ths.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return ths.take()
+}
+
+func (ths *Limiter) waitPause(ctx context.Context) error {
+	for {
+		ths.mu.Lock()
+		aborted := ths.aborted
+		wait := time.Until(ths.pausedUntil)
+		ths.mu.Unlock()
+
+		if aborted != nil {
+			return aborted
+		}
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (ths *Limiter) take() error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	if ths.aborted != nil {
+		return ths.aborted
+	}
+
+	today := time.Now().Format("2006-01-02")
+	if today != ths.day {
+		ths.day = today
+		ths.used = 0
+	}
+	if ths.dailyCap > 0 && ths.used >= ths.dailyCap {
+		return ErrDailyCapReached
+	}
+	ths.used++
+	return nil
+}
+
+// 根据返回码调整限流状态
+func (ths *Limiter) Observe(code string) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	switch code {
+	case OVER_QUERY_LIMIT:
+		until := time.Now().Add(ths.pause)
+		if until.After(ths.pausedUntil) {
+			ths.pausedUntil = until
+			log.Warnf("ADV_ %s, pause all requests for %s", code, ths.pause)
+		}
+	case INSUFFICIENT_BALANCE:
+		if ths.aborted == nil {
+			ths.aborted = ErrInsufficientBalance
+			log.Errorf("ADV_ %s, abort all requests", code)
+		}
+	}
+}
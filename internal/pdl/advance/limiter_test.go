@@ -0,0 +1,79 @@
+package advance_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/advance"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+)
+
+func TestLimiterQps(t *testing.T) {
+	t.Parallel()
+
+	limiter := advance.NewLimiter(20, 1, 0, time.Minute)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 首个令牌立即可用，其余每 50ms 一个
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected 5 requests at 20 qps to take 200ms, took %s", elapsed)
+	}
+}
+
+func TestLimiterDailyCap(t *testing.T) {
+	t.Parallel()
+
+	limiter := advance.NewLimiter(0, 1, 3, time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := limiter.Wait(context.Background())
+	if !errors.Is(err, advance.ErrDailyCapReached) || !errors.Is(err, ocr.ErrQuotaExhausted) {
+		t.Errorf("expected daily cap reached, got %v", err)
+	}
+
+	// 重启后从调用明细恢复的计数同样受上限约束
+	restarted := advance.NewLimiter(0, 1, 3, time.Minute)
+	restarted.SetUsed(2)
+	if err := restarted.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Wait(context.Background()); !errors.Is(err, advance.ErrDailyCapReached) {
+		t.Errorf("expected daily cap reached after restart, got %v", err)
+	}
+}
+
+func TestLimiterPause(t *testing.T) {
+	t.Parallel()
+
+	limiter := advance.NewLimiter(0, 1, 0, 100*time.Millisecond)
+	limiter.Observe(advance.OVER_QUERY_LIMIT)
+	start := time.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected requests paused for 100ms, resumed after %s", elapsed)
+	}
+
+	// 暂停期间取消
+	limiter.Observe(advance.OVER_QUERY_LIMIT)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded while paused, got %v", err)
+	}
+
+	limiter.Observe(advance.INSUFFICIENT_BALANCE)
+	if err := limiter.Wait(context.Background()); !errors.Is(err, advance.ErrInsufficientBalance) {
+		t.Errorf("expected insufficient balance, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package advance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+)
+
+var (
+	defaultRetryableCodes  = []string{SERVICE_BUSY, OVER_QUERY_LIMIT, ERROR}
+	defaultTerminalCodes   = []string{EMPTY_PARAMETER_ERROR, PARAMETER_ERROR, CARD_TYPE_NOT_MATCH, NO_SUPPORTED_CARD, TOO_MANY_CARDS, OCR_NO_RESULT}
+	defaultRetryableStatus = []int{429, 500, 502, 503, 504}
+)
+
+// HTTP 非 200 响应
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+func (ths *StatusError) Error() string {
+	return fmt.Sprintf("ADV_ HTTP status %d: %s", ths.Status, ths.Body)
+}
+
+// 重试策略：指数退避加随机抖动，按返回码和 HTTP 状态区分可重试与永久失败
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	Multiplier      float64
+	Jitter          float64
+	retryableCodes  map[string]bool
+	terminalCodes   map[string]bool
+	retryableStatus map[int]bool
+}
+
+// 未配置的项使用默认值
+func NewRetryPolicy(cfg config.RetryConfig) *RetryPolicy {
+	policy := &RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.MaxBackoff) * time.Millisecond,
+		Multiplier:     cfg.Multiplier,
+		Jitter:         cfg.Jitter,
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = 500 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 10 * time.Second
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		policy.Jitter = 0.2
+	}
+
+	retryableCodes := cfg.RetryableCodes
+	if len(retryableCodes) == 0 {
+		retryableCodes = defaultRetryableCodes
+	}
+	terminalCodes := cfg.TerminalCodes
+	if len(terminalCodes) == 0 {
+		terminalCodes = defaultTerminalCodes
+	}
+	retryableStatus := cfg.RetryableStatus
+	if len(retryableStatus) == 0 {
+		retryableStatus = defaultRetryableStatus
+	}
+
+	policy.retryableCodes = toSet(retryableCodes)
+	policy.terminalCodes = toSet(terminalCodes)
+	policy.retryableStatus = make(map[int]bool, len(retryableStatus))
+	for _, status := range retryableStatus {
+		policy.retryableStatus[status] = true
+	}
+	return policy
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// 永久失败的返回码，重试也不会成功（收费码重试还会重复计费）
+func (ths *RetryPolicy) IsTerminal(code string) bool {
+	return ths.terminalCodes[code]
+}
+
+// 第 attempt 次调用后是否继续重试
+func (ths *RetryPolicy) ShouldRetry(attempt ocr.Attempt, err error) bool {
+	if attempt.No >= ths.MaxAttempts {
+		return false
+	}
+	if err == nil {
+		return ths.retryableCodes[attempt.Code]
+	}
+	if ocr.IsQuotaExhausted(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return ths.retryableStatus[statusErr.Status]
+	}
+	// 网络错误
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// 第 attempt 次调用后的等待时长
+func (ths *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(ths.InitialBackoff) * math.Pow(ths.Multiplier, float64(attempt-1))
+	if backoff > float64(ths.MaxBackoff) {
+		backoff = float64(ths.MaxBackoff)
+	}
+	if ths.Jitter > 0 {
+		backoff += backoff * ths.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(backoff)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
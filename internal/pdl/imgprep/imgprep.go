@@ -0,0 +1,163 @@
+package imgprep
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"runtime"
+
+	"github.com/onlythinking/pug-go/internal/config"
+)
+
+// 拒绝的图片记录的返回码
+const RejectedCode = "IMAGE_REJECTED"
+
+// 图片不符合要求，不应提交 OCR
+type RejectedError struct {
+	Reason string
+}
+
+func (ths *RejectedError) Error() string {
+	return "image rejected: " + ths.Reason
+}
+
+func IsRejected(err error) bool {
+	var rejected *RejectedError
+	return errors.As(err, &rejected)
+}
+
+func reject(format string, args ...interface{}) error {
+	return &RejectedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// 识别前的图片预处理：按 EXIF 方向摆正、缩小到最大尺寸和字节数、重新编码为 JPEG，
+// 拒绝非图片和过小的图片。已符合要求的 JPEG 原样返回
+type Preprocessor struct {
+	Workers      int
+	MaxDimension int
+	MaxBytes     int
+	MinDimension int
+	MinBytes     int
+	Quality      int
+}
+
+// 未配置的项使用默认值
+func NewPreprocessor(cfg config.PreprocessConfig) *Preprocessor {
+	p := &Preprocessor{
+		Workers:      cfg.Workers,
+		MaxDimension: cfg.MaxDimension,
+		MaxBytes:     cfg.MaxBytes,
+		MinDimension: cfg.MinDimension,
+		MinBytes:     cfg.MinBytes,
+		Quality:      cfg.Quality,
+	}
+	if p.Workers <= 0 {
+		p.Workers = runtime.NumCPU()
+	}
+	if p.MaxDimension <= 0 {
+		p.MaxDimension = 2048
+	}
+	if p.MaxBytes <= 0 {
+		p.MaxBytes = 2 * 1024 * 1024
+	}
+	if p.MinDimension <= 0 {
+		p.MinDimension = 200
+	}
+	if p.MinBytes <= 0 {
+		p.MinBytes = 1024
+	}
+	if p.Quality <= 0 || p.Quality > 100 {
+		p.Quality = 85
+	}
+	return p
+}
+
+// 最低 JPEG 质量，低于此值仍超过 MaxBytes 时继续缩小尺寸
+const minQuality = 50
+
+// 解码前允许的最大像素数为 MaxDimension 平方的倍数，避免声明超大尺寸的小文件耗尽内存
+const maxPixelsFactor = 16
+
+func (ths *Preprocessor) Process(data []byte) ([]byte, error) {
+	if len(data) < ths.MinBytes {
+		return nil, reject("%d bytes is smaller than %d", len(data), ths.MinBytes)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, reject("not a supported image: %s", err)
+	}
+	if min(cfg.Width, cfg.Height) < ths.MinDimension {
+		return nil, reject("%dx%d is smaller than %d pixels", cfg.Width, cfg.Height, ths.MinDimension)
+	}
+	if maxPixels := maxPixelsFactor * int64(ths.MaxDimension) * int64(ths.MaxDimension); int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, reject("%dx%d is larger than %d pixels", cfg.Width, cfg.Height, maxPixels)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	if format == "jpeg" && orientation == 1 && max(cfg.Width, cfg.Height) <= ths.MaxDimension && len(data) <= ths.MaxBytes {
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, reject("decode %s: %s", format, err)
+	}
+	rgba := toRGBA(img)
+	rgba = orient(rgba, orientation)
+
+	dimension := ths.MaxDimension
+	for {
+		scaled := downscale(rgba, dimension)
+		for quality := ths.Quality; ; quality -= 10 {
+			if quality < minQuality {
+				quality = minQuality
+			}
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality}); err != nil {
+				return nil, err
+			}
+			if buf.Len() <= ths.MaxBytes {
+				return buf.Bytes(), nil
+			}
+			if quality == minQuality {
+				break
+			}
+		}
+		dimension = max(scaled.Bounds().Dx(), scaled.Bounds().Dy()) * 3 / 4
+		if min(scaled.Bounds().Dx(), scaled.Bounds().Dy())*3/4 < ths.MinDimension {
+			return nil, reject("cannot fit in %d bytes", ths.MaxBytes)
+		}
+	}
+}
+
+// 转为 RGBA，透明部分填充白色
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Over)
+	return rgba
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,176 @@
+package imgprep_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/imgprep"
+)
+
+// 左半部分红色，右半部分蓝色
+func newImage(w int, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x < w/2 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJpeg(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 在 SOI 之后插入带方向的 EXIF
+func withOrientation(data []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" {
+		t.Fatalf("expected jpeg, got %s", format)
+	}
+	return img
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestProcessOrientation(t *testing.T) {
+	p := imgprep.NewPreprocessor(config.PreprocessConfig{})
+	data := withOrientation(encodeJpeg(t, newImage(400, 300)), 6)
+
+	out, err := p.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := decode(t, out)
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 400 {
+		t.Fatalf("expected 300x400, got %v", b)
+	}
+	// 顺时针旋转 90° 后左半部分在上方
+	if !isRed(img.At(150, 50)) || isRed(img.At(150, 350)) {
+		t.Errorf("unexpected rotation")
+	}
+}
+
+func TestProcessDownscale(t *testing.T) {
+	p := imgprep.NewPreprocessor(config.PreprocessConfig{MaxDimension: 1000})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newImage(3000, 1500)); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := p.Process(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := decode(t, out)
+	if b := img.Bounds(); b.Dx() != 1000 || b.Dy() != 500 {
+		t.Fatalf("expected 1000x500, got %v", b)
+	}
+	if !isRed(img.At(100, 250)) || isRed(img.At(900, 250)) {
+		t.Errorf("unexpected content after downscale")
+	}
+}
+
+func TestProcessMaxBytes(t *testing.T) {
+	// 随机噪点难以压缩
+	img := image.NewRGBA(image.Rect(0, 0, 800, 800))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	data := encodeJpeg(t, img)
+
+	p := imgprep.NewPreprocessor(config.PreprocessConfig{MaxBytes: len(data) / 4})
+	out, err := p.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > len(data)/4 {
+		t.Errorf("expected at most %d bytes, got %d", len(data)/4, len(out))
+	}
+
+	p = imgprep.NewPreprocessor(config.PreprocessConfig{MaxBytes: 2000, MinBytes: 10})
+	if _, err := p.Process(data); !imgprep.IsRejected(err) {
+		t.Errorf("expected rejected, got %v", err)
+	}
+}
+
+func TestProcessKeepsValidJpeg(t *testing.T) {
+	p := imgprep.NewPreprocessor(config.PreprocessConfig{})
+	data := encodeJpeg(t, newImage(400, 300))
+	out, err := p.Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("expected valid jpeg unchanged")
+	}
+}
+
+// 逻辑屏幕声明为 w x h 的 GIF，实际只有 300x300
+func oversizedGif(t *testing.T, w uint16, h uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, newImage(300, 300), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[6:], w)
+	binary.LittleEndian.PutUint16(data[8:], h)
+	return data
+}
+
+func TestProcessRejects(t *testing.T) {
+	p := imgprep.NewPreprocessor(config.PreprocessConfig{MinBytes: 10})
+	for name, data := range map[string][]byte{
+		"text":  bytes.Repeat([]byte("not an image "), 100),
+		"tiny":  encodeJpeg(t, newImage(100, 300)),
+		"bytes": []byte("GIF8"),
+		"huge":  oversizedGif(t, 40000, 40000),
+	} {
+		if _, err := p.Process(data); !imgprep.IsRejected(err) {
+			t.Errorf("%s: expected rejected, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package loan
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 按图片内容缓存的识别结果，同一张图片用于多个客户时只调用一次 OCR
+type OcrImageCache struct {
+	Id            string    `json:"id" gorm:"primary_key;type:varchar(120);comment:'图片摘要|证件类型'"`
+	InstTime      time.Time `json:"instTime" gorm:"column:INST_TIME;type:datetime;comment:'插入时间'"`
+	UpdtTime      time.Time `json:"updtTime" gorm:"column:UPDT_TIME;type:datetime;comment:'修改时间'"`
+	ImageHash     string    `json:"imageHash" gorm:"column:IMAGE_HASH;type:varchar(80);comment:'图片内容MD5或S3 ETag'"`
+	CardType      string    `json:"cardType" gorm:"column:CARD_TYPE;type:varchar(40);comment:'证件类型'"`
+	CustNo        string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);comment:'首次识别的客户编码'"`
+	BusiType      string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(40);comment:'业务类型（码类：1007）'"`
+	Provider      string    `json:"provider" gorm:"column:PROVIDER;type:varchar(40);comment:'OCR服务商'"`
+	AdvCode       string    `json:"advCode" gorm:"column:ADV_CODE;type:varchar(200);comment:'ADV返回code'"`
+	Message       string    `json:"message" gorm:"column:MESSAGE;type:varchar(200);comment:'ADV返回message'"`
+	Success       bool      `json:"success" gorm:"column:SUCCESS;comment:'是否识别成功'"`
+	TransactionId string    `json:"transactionId" gorm:"column:TRANSACTION_ID;type:varchar(80);comment:'ADV响应的transactionId'"`
+	Fields        string    `json:"fields" gorm:"column:FIELDS;type:varchar(4000);comment:'证件字段（JSON）'"`
+	Hits          int       `json:"hits" gorm:"column:HITS;type:int;comment:'复用次数'"`
+}
+
+func (OcrImageCache) TableName() string {
+	return "pdl_ocr_image_cache"
+}
+
+// 可提供对象 ETag 的下载器。单段上传且未使用 KMS 加密的对象 ETag 即内容 MD5，
+// 下载前即可命中缓存；其他 ETag 与内容 MD5 不同，只会错过缓存
+type ETagLookup interface {
+	ETag(ctx context.Context, key string) (string, error)
+}
+
+// 识别结果缓存：内存中记录本批次处理中的图片，相同图片的任务等待首个任务的结果；
+// 成功和永久失败的结果落库供后续批次复用
+type ImageCache struct {
+	repo    ImageCacheRepo
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	hits    int64
+}
+
+type cacheEntry struct {
+	done   chan struct{}
+	result *ocr.Result
+}
+
+func NewImageCache(repo ImageCacheRepo) *ImageCache {
+	return &ImageCache{repo: repo, entries: make(map[string]*cacheEntry)}
+}
+
+func cacheKey(hash string, cardType string) string {
+	return hash + "|" + cardType
+}
+
+// 复用的次数
+func (ths *ImageCache) Hits() int64 {
+	return atomic.LoadInt64(&ths.hits)
+}
+
+// 查询已有结果，不等待处理中的图片
+func (ths *ImageCache) Lookup(hash string, cardType string) *ocr.Result {
+	key := cacheKey(hash, cardType)
+	ths.mu.Lock()
+	entry, ok := ths.entries[key]
+	ths.mu.Unlock()
+	if ok {
+		select {
+		case <-entry.done:
+			if entry.result != nil {
+				return entry.result
+			}
+		default:
+		}
+	}
+	return ths.find(key)
+}
+
+// 获取图片的识别结果。已有结果时直接返回；其他任务正在识别时等待其结果；
+// 否则返回 owner 为 true，调用方识别后须调用 release
+func (ths *ImageCache) acquire(ctx context.Context, hash string, cardType string) (*ocr.Result, bool, error) {
+	key := cacheKey(hash, cardType)
+	for {
+		ths.mu.Lock()
+		entry, ok := ths.entries[key]
+		if !ok {
+			entry = &cacheEntry{done: make(chan struct{})}
+			ths.entries[key] = entry
+			ths.mu.Unlock()
+
+			if result := ths.find(key); result != nil {
+				entry.result = result
+				close(entry.done)
+				return ths.hit(key, result), false, nil
+			}
+			return nil, true, nil
+		}
+		ths.mu.Unlock()
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, false, ErrInterrupted
+		}
+		if entry.result != nil {
+			return ths.hit(key, entry.result), false, nil
+		}
+		// 首个任务未得到可复用的结果，重新竞争
+	}
+}
+
+// 结束识别，成功或永久失败的结果落库，其他情况移除记录由后续任务重新识别
+func (ths *ImageCache) release(hash string, cardType string, file *LoanFile, result *ocr.Result) {
+	key := cacheKey(hash, cardType)
+	if result == nil || !(result.Success || result.Terminal) {
+		ths.mu.Lock()
+		entry := ths.entries[key]
+		delete(ths.entries, key)
+		ths.mu.Unlock()
+		if entry != nil {
+			close(entry.done)
+		}
+		return
+	}
+
+	ths.save(key, hash, cardType, file, result)
+	ths.mu.Lock()
+	entry := ths.entries[key]
+	ths.mu.Unlock()
+	if entry != nil {
+		entry.result = cachedResult(result)
+		close(entry.done)
+	}
+}
+
+func (ths *ImageCache) hit(key string, result *ocr.Result) *ocr.Result {
+	atomic.AddInt64(&ths.hits, 1)
+	if err := ths.repo.Hit(key, time.Now()); err != nil {
+		log.Errorf("Update ocr image cache %s err: %s", key, err)
+	}
+	return result
+}
+
+// 复用的结果不含调用记录，不收费
+func cachedResult(result *ocr.Result) *ocr.Result {
+	return &ocr.Result{
+		Provider:      result.Provider,
+		Code:          result.Code,
+		Message:       result.Message,
+		Success:       result.Success,
+		Terminal:      result.Terminal,
+		TransactionId: result.TransactionId,
+		CardType:      result.CardType,
+		Fields:        result.Fields,
+	}
+}
+
+func (ths *ImageCache) find(key string) *ocr.Result {
+	cache, err := ths.repo.Find(key)
+	if err != nil {
+		log.Errorf("Find ocr image cache %s err: %s", key, err)
+		return nil
+	}
+	if cache == nil {
+		return nil
+	}
+	result := &ocr.Result{
+		Provider:      cache.Provider,
+		Code:          cache.AdvCode,
+		Message:       cache.Message,
+		Success:       cache.Success,
+		Terminal:      !cache.Success,
+		TransactionId: cache.TransactionId,
+		CardType:      cache.CardType,
+	}
+	if cache.Fields != "" {
+		if err := json.Unmarshal([]byte(cache.Fields), &result.Fields); err != nil {
+			log.Errorf("Ocr image cache %s fields err: %s", key, err)
+			return nil
+		}
+	}
+	return result
+}
+
+func (ths *ImageCache) save(key string, hash string, cardType string, file *LoanFile, result *ocr.Result) {
+	fields, err := json.Marshal(result.Fields)
+	if err != nil {
+		log.Errorf("Ocr image cache fields to json err: %s", err)
+		return
+	}
+	now := time.Now()
+	cache := OcrImageCache{
+		Id:            key,
+		InstTime:      now,
+		UpdtTime:      now,
+		ImageHash:     hash,
+		CardType:      cardType,
+		CustNo:        file.CustNo,
+		BusiType:      file.BusiType,
+		Provider:      result.Provider,
+		AdvCode:       result.Code,
+		Message:       truncate(result.Message, 200),
+		Success:       result.Success,
+		TransactionId: result.TransactionId,
+		Fields:        string(fields),
+	}
+	if err := ths.repo.Save(&cache); err != nil {
+		log.Errorf("Save ocr image cache %s err: %s", key, err)
+	}
+}
+
+// 图片内容摘要（MD5，与单段上传对象的 S3 ETag 一致）
+func imageHash(image []byte) string {
+	sum := md5.Sum(image)
+	return hex.EncodeToString(sum[:])
+}
+
+func fileHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 多段上传的 ETag 带有 -N 后缀，与内容 MD5 无关
+func etagHash(etag string) (string, bool) {
+	etag = strings.Trim(etag, `"`)
+	if len(etag) != md5.Size*2 || strings.Contains(etag, "-") {
+		return "", false
+	}
+	return strings.ToLower(etag), true
+}
@@ -0,0 +1,95 @@
+package loan_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+)
+
+// 可查询 ETag 的下载器，ETag 为内容 MD5
+type etagDownloader struct {
+	*fakeDownloader
+	heads int64
+}
+
+func (ths *etagDownloader) ETag(ctx context.Context, key string) (string, error) {
+	atomic.AddInt64(&ths.heads, 1)
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	sum := md5.Sum(ths.image(key))
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+func TestBatchOcrReusesSameImage(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	excelPath := writeExcel(t, "C0090001", "C0090002", "C0090003")
+	// C0090002 与 C0090001 使用相同图片
+	same := filepath.Join(baseDir, t.Name(), "C0090002.jpg")
+	if err := ioutil.WriteFile(same, fakeImage(filepath.Join(t.Name(), "C0090001.jpg")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(&eventRecords)
+
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 3 || summary.Succeeded != 3 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if got := len(server.Requests()); got != 2 {
+		t.Errorf("expected 2 OCR requests, got %d", got)
+	}
+	if got := count(t, db, &loan.CuCustOcrResultDtl{}); got != 3 {
+		t.Errorf("expected a result per customer, got %d", got)
+	}
+	if got := count(t, db, &loan.OcrAttempt{}); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+	if got := atomic.LoadInt64(&eventRecords) - before; got != 2 {
+		t.Errorf("expected 2 event records, got %d", got)
+	}
+	for custNo, job := range jobStatus(t, db) {
+		if job.Status != loan.JobSucceeded {
+			t.Errorf("unexpected job %s %#v", custNo, job)
+		}
+	}
+
+	// 后续批次按 ETag 命中缓存，不再下载和识别
+	downloader := &etagDownloader{fakeDownloader: newFakeDownloader()}
+	svc = initClient(db, server, downloader)
+	src := writeFile(t, "next.csv", "custNo,busiType,inPath\nC0090004,1,pan/C0090004.jpg\nC0090005,1,pan/C0090005.jpg\n")
+	downloader.images["pan/C0090004.jpg"] = fakeImage(filepath.Join(t.Name(), "C0090003.jpg"))
+
+	summary = svc.BatchDownloadAndOcr(context.Background(), loan.NewCsvSource(src), true)
+	if summary.Total != 2 || summary.Succeeded != 2 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if got := downloader.count("pan/C0090004.jpg"); got != 0 {
+		t.Errorf("expected cached image not downloaded, got %d", got)
+	}
+	if got := downloader.count("pan/C0090005.jpg"); got != 1 {
+		t.Errorf("expected new image downloaded, got %d", got)
+	}
+	if got := len(server.Requests()); got != 3 {
+		t.Errorf("expected 1 more OCR request, got %d", got)
+	}
+	if got := atomic.LoadInt64(&downloader.heads); got != 2 {
+		t.Errorf("expected 2 head requests, got %d", got)
+	}
+
+	var cache loan.OcrImageCache
+	if err := db.Where("CUST_NO = ?", "C0090001").First(&cache).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cache.Hits != 1 || !cache.Success {
+		t.Errorf("unexpected cache %#v", cache)
+	}
+}
@@ -0,0 +1,206 @@
+package loan
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onlythinking/pug-go/pkg/excel"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 没有任务台账和识别结果的数据
+const ReportNotStarted = "NOT_STARTED"
+
+const reportTimeLayout = "2006-01-02 15:04:05"
+
+var reportHeader = []string{
+	"row", ColCustNo, ColBusiType, ColInPath, ColAppNo, ColPhoneNo, ColHolderName, "status",
+	"panNo", "custName", "birthday", "fatherName", "verifyStatus", "verifyMessage", "advCode", "message",
+	"paid", "paidCalls", "attempts", "startTime", "updateTime", "resultTime",
+}
+
+// 导出条件，为空的条件不过滤
+type ExportFilter struct {
+	// 处理时间范围 [From, To)，未处理的数据在指定时间范围时不导出
+	From time.Time
+	To   time.Time
+	// 任务状态，见 JobSucceeded 等以及 ReportNotStarted
+	Statuses  []string
+	BusiTypes []string
+}
+
+func (ths ExportFilter) match(row *ReportRow) bool {
+	if !ths.From.IsZero() || !ths.To.IsZero() {
+		t := row.processedTime()
+		if t.IsZero() || (!ths.From.IsZero() && t.Before(ths.From)) || (!ths.To.IsZero() && !t.Before(ths.To)) {
+			return false
+		}
+	}
+	return contains(ths.Statuses, row.Status) && contains(ths.BusiTypes, row.File.BusiType)
+}
+
+func contains(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// 导出报表的一行：源数据、识别结果和任务台账
+type ReportRow struct {
+	Row       int
+	File      LoanFile
+	Status    string
+	Result    *CuCustOcrResultDtl
+	Job       *OcrJob
+	PaidCalls int
+}
+
+// 最后处理时间
+func (ths *ReportRow) processedTime() time.Time {
+	if ths.Job != nil {
+		return ths.Job.UpdtTime
+	}
+	if ths.Result != nil {
+		return ths.Result.UpdtTime
+	}
+	return time.Time{}
+}
+
+func (ths *ReportRow) cells() []string {
+	var code, message, startTime, updateTime, resultTime, attempts string
+	result := CuCustOcrResultDtl{}
+	if ths.Job != nil {
+		code = ths.Job.LastCode
+		message = ths.Job.LastError
+		attempts = strconv.Itoa(ths.Job.Attempts)
+		startTime = formatTime(ths.Job.InstTime)
+		updateTime = formatTime(ths.Job.UpdtTime)
+	}
+	if ths.Result != nil {
+		result = *ths.Result
+		code = result.AdvCode
+		message = result.Message
+		resultTime = formatTime(result.InstTime)
+	}
+	paid := "N"
+	if ths.PaidCalls > 0 {
+		paid = "Y"
+	}
+	file := ths.File
+	return []string{
+		strconv.Itoa(ths.Row), file.CustNo, file.BusiType, file.InPath, file.AppNo, file.PhoneNo, file.HolderName, ths.Status,
+		result.PanNo, result.CustName, result.Birthday, result.FatherName, result.VerifyStatus, result.VerifyMessage, code, message,
+		paid, strconv.Itoa(ths.PaidCalls), attempts, startTime, updateTime, resultTime,
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(reportTimeLayout)
+}
+
+// 报表写入，按扩展名支持 .xlsx 和 .csv
+type reportWriter interface {
+	Write(cells []string) error
+	Close() error
+}
+
+type csvReportWriter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func (ths *csvReportWriter) Write(cells []string) error {
+	return ths.w.Write(cells)
+}
+
+func (ths *csvReportWriter) Close() error {
+	ths.w.Flush()
+	err := ths.w.Error()
+	if cerr := ths.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func createReport(filename string) (reportWriter, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return excel.Create(filename, "report")
+	case ".csv":
+		f, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &csvReportWriter{f: f, w: csv.NewWriter(f)}, nil
+	}
+	return nil, fmt.Errorf("unsupported report %s, expected .xlsx or .csv", filename)
+}
+
+// 按源数据逐行关联识别结果和任务台账，导出到 filename，返回导出行数
+func (ths *Service) ExportReport(src Source, filter ExportFilter, filename string) (int, error) {
+	writer, err := createReport(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := ths.exportReport(src, filter, writer)
+	if cerr := writer.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return count, err
+	}
+	log.Infof("导出 %s 共 %d 行，校验未通过 %d 行", filename, count, len(src.Rejected()))
+	return count, nil
+}
+
+func (ths *Service) exportReport(src Source, filter ExportFilter, writer reportWriter) (int, error) {
+	results, err := ths.repos.Results.LatestAll()
+	if err != nil {
+		return 0, err
+	}
+	paidCalls, err := ths.repos.Attempts.PaidCalls()
+	if err != nil {
+		return 0, err
+	}
+	jobs, err := ths.repos.Jobs.All()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := writer.Write(reportHeader); err != nil {
+		return 0, err
+	}
+	count := 0
+	err = src.Each(func(row int, file LoanFile) error {
+		key := jobKey(file.CustNo, file.BusiType)
+		r := &ReportRow{Row: row, File: file, Status: ReportNotStarted, Result: results[key], Job: jobs[key], PaidCalls: paidCalls[key]}
+		switch {
+		case r.Job != nil:
+			r.Status = r.Job.Status
+		case r.Result != nil:
+			// 台账之前的历史结果
+			r.Status = JobSucceeded
+		}
+		if !filter.match(r) {
+			return nil
+		}
+		count++
+		return writer.Write(r.cells())
+	})
+	return count, err
+}
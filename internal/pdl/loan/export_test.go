@@ -0,0 +1,103 @@
+package loan_test
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/advance"
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/pkg/excel"
+)
+
+func readCsv(t *testing.T, filename string) [][]string {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestExportReport(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	server.Script("C0080001.jpg", advancetest.Success(map[string]string{"idNumber": "ABCDE1234F", "name": "RAVI KUMAR", "fatherName": "RAM KUMAR"}))
+	server.Script("C0080002.jpg", advancetest.Code(advance.NO_SUPPORTED_CARD))
+	excelPath := writeExcel(t, "C0080001", "C0080002")
+	svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+
+	// C0080003 未处理
+	excelPath = writeExcel(t, "C0080001", "C0080002", "C0080003", "C0080004")
+	// 台账之前的历史结果
+	history := loan.CuCustOcrResultDtl{Id: "history", CustNo: "C0080004", BusiType: "1", AdvCode: advance.SUCCESS,
+		PanNo: "ZZZZZ9999Z", InstTime: time.Now(), UpdtTime: time.Now()}
+	if err := db.Create(&history).Error; err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(t.TempDir(), "report.csv")
+
+	count, err := svc.ExportReport(loan.NewExcelSource(excelPath), loan.ExportFilter{}, csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readCsv(t, csvPath)
+	if count != 4 || len(records) != 5 {
+		t.Fatalf("unexpected report %d %v", count, records)
+	}
+	column := map[string]int{}
+	for i, name := range records[0] {
+		column[name] = i
+	}
+	want := map[string][]string{
+		"C0080001": {loan.JobSucceeded, "ABCDE1234F", "RAVI KUMAR", "RAM KUMAR", advance.SUCCESS, "Y"},
+		"C0080002": {loan.JobSkipped, "", "", "", advance.NO_SUPPORTED_CARD, "Y"},
+		"C0080003": {loan.ReportNotStarted, "", "", "", "", "N"},
+		"C0080004": {loan.JobSucceeded, "ZZZZZ9999Z", "", "", advance.SUCCESS, "N"},
+	}
+	for _, record := range records[1:] {
+		got := []string{record[column["status"]], record[column["panNo"]], record[column["custName"]],
+			record[column["fatherName"]], record[column["advCode"]], record[column["paid"]]}
+		if w := want[record[column["custNo"]]]; !reflect.DeepEqual(got, w) {
+			t.Errorf("unexpected report row %v, expected %v", got, w)
+		}
+	}
+
+	// 按状态和处理日期过滤，导出 xlsx
+	xlsxPath := filepath.Join(t.TempDir(), "report.xlsx")
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	filter := loan.ExportFilter{From: today.AddDate(0, 0, -1), To: today.AddDate(0, 0, 2), Statuses: []string{"skipped"}}
+	if count, err := svc.ExportReport(loan.NewExcelSource(excelPath), filter, xlsxPath); err != nil || count != 1 {
+		t.Fatalf("expected 1 row, got %d %v", count, err)
+	}
+	reader, err := excel.Open(xlsxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	reader.Next()
+	if _, cells, err := reader.Next(); err != nil || cells[column["custNo"]] != "C0080002" {
+		t.Errorf("unexpected xlsx row %v %v", cells, err)
+	}
+
+	filter = loan.ExportFilter{To: today.AddDate(0, 0, -1)}
+	if count, err := svc.ExportReport(loan.NewExcelSource(excelPath), filter, csvPath); err != nil || count != 0 {
+		t.Errorf("expected no rows before yesterday, got %d %v", count, err)
+	}
+	if _, err := svc.ExportReport(loan.NewExcelSource(excelPath), loan.ExportFilter{}, "report.txt"); err == nil {
+		t.Error("expected error for unsupported report")
+	}
+}
@@ -0,0 +1,335 @@
+package loan
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 输入字段
+const (
+	ColCustNo   = "custNo"
+	ColBusiType = "busiType"
+	ColInPath   = "inPath"
+	ColAppNo    = "appNo"
+	ColPhoneNo  = "phoneNo"
+	// 可选，已有的客户姓名
+	ColHolderName = "holderName"
+)
+
+// 无表头时的列顺序
+var positionalColumns = []string{ColCustNo, ColBusiType, ColInPath, ColAppNo, ColPhoneNo, ColHolderName}
+
+// 默认表头别名，比较时忽略大小写、空格、下划线和中划线
+var defaultColumnAliases = map[string][]string{
+	ColCustNo:     {"custNo", "customerNo", "客户编号", "客户号"},
+	ColBusiType:   {"busiType", "businessType", "业务类型"},
+	ColInPath:     {"inPath", "path", "url", "imgUrl", "imageUrl", "图片地址", "图片"},
+	ColAppNo:      {"appNo", "app", "APP编号"},
+	ColPhoneNo:    {"phoneNo", "phone", "mobile", "mobileNo", "registNo", "手机号"},
+	ColHolderName: {"holderName", "custName", "customerName", "客户姓名", "姓名"},
+}
+
+const (
+	defaultCustNoPattern = `^[A-Za-z0-9]{4,40}$`
+	defaultPhonePattern  = `^(\+?91)?[6-9][0-9]{9}$`
+)
+
+// 校验未通过的行
+type Rejected struct {
+	Row    int      `json:"row"` // 源数据中的行号，从 1 开始（含表头）
+	Reason string   `json:"reason"`
+	File   LoanFile `json:"file"`
+}
+
+// 表头到字段的映射
+type ColumnMapping struct {
+	index map[string]int
+}
+
+// 按表头建立映射，表头中没有可识别的列时返回 nil（按列顺序解析）
+func NewColumnMapping(header []string, aliases map[string][]string) (*ColumnMapping, error) {
+	lookup := make(map[string]string)
+	for _, all := range []map[string][]string{defaultColumnAliases, aliases} {
+		for field, names := range all {
+			for _, name := range append([]string{field}, names...) {
+				lookup[normalizeColumn(name)] = field
+			}
+		}
+	}
+
+	mapping := &ColumnMapping{index: make(map[string]int)}
+	for i, name := range header {
+		field, ok := lookup[normalizeColumn(name)]
+		if !ok {
+			continue
+		}
+		if _, dup := mapping.index[field]; dup {
+			return nil, fmt.Errorf("duplicate column %s for %s", name, field)
+		}
+		mapping.index[field] = i
+	}
+	if len(mapping.index) == 0 {
+		return nil, nil
+	}
+	for _, field := range []string{ColCustNo, ColInPath} {
+		if _, ok := mapping.index[field]; !ok {
+			return nil, fmt.Errorf("missing column %s in header %v", field, header)
+		}
+	}
+	return mapping, nil
+}
+
+// 按列顺序 custNo, busiType, inPath, appNo, phoneNo, holderName 映射
+func positionalMapping() *ColumnMapping {
+	mapping := &ColumnMapping{index: make(map[string]int)}
+	for i, field := range positionalColumns {
+		mapping.index[field] = i
+	}
+	return mapping
+}
+
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.TrimSpace(name)))
+}
+
+// 取出一行数据，未去掉图片域名
+func (ths *ColumnMapping) LoanFile(row []string) LoanFile {
+	cell := func(field string) string {
+		if i, ok := ths.index[field]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	return LoanFile{
+		CustNo:     cell(ColCustNo),
+		BusiType:   cell(ColBusiType),
+		InPath:     cell(ColInPath),
+		AppNo:      cell(ColAppNo),
+		PhoneNo:    cell(ColPhoneNo),
+		HolderName: cell(ColHolderName),
+	}
+}
+
+// 行数据校验
+type Validator struct {
+	custNo    *regexp.Regexp
+	phone     *regexp.Regexp
+	busiTypes map[string]bool
+}
+
+// 未配置业务类型时使用 OCR 配置中出现的业务类型，仍为空时不限制
+func NewValidator(input config.InputConfig, ocrCfg config.OcrConfig) (*Validator, error) {
+	custNoPattern := input.CustNoPattern
+	if custNoPattern == "" {
+		custNoPattern = defaultCustNoPattern
+	}
+	custNo, err := regexp.Compile(custNoPattern)
+	if err != nil {
+		return nil, fmt.Errorf("custNoPattern: %w", err)
+	}
+	phonePattern := input.PhonePattern
+	if phonePattern == "" {
+		phonePattern = defaultPhonePattern
+	}
+	phone, err := regexp.Compile(phonePattern)
+	if err != nil {
+		return nil, fmt.Errorf("phonePattern: %w", err)
+	}
+
+	busiTypes := toSet(input.BusiTypes)
+	if len(busiTypes) == 0 {
+		for busiType := range ocrCfg.Providers {
+			busiTypes[busiType] = true
+		}
+		for busiType := range ocrCfg.CardTypes {
+			busiTypes[busiType] = true
+		}
+	}
+	return &Validator{custNo: custNo, phone: phone, busiTypes: busiTypes}, nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// 校验已去掉图片域名的数据
+func (ths *Validator) Validate(file LoanFile) error {
+	if !ths.custNo.MatchString(file.CustNo) {
+		return fmt.Errorf("invalid custNo %q", file.CustNo)
+	}
+	if file.BusiType == "" {
+		return errors.New("busiType is empty")
+	}
+	if len(ths.busiTypes) > 0 && !ths.busiTypes[file.BusiType] {
+		return fmt.Errorf("unknown busiType %q", file.BusiType)
+	}
+	if file.PhoneNo != "" && !ths.phone.MatchString(file.PhoneNo) {
+		return fmt.Errorf("invalid phoneNo %q", file.PhoneNo)
+	}
+	return validateKey(file.InPath)
+}
+
+// inPath 须为 S3 key、s3://bucket/key 或可识别的图片地址
+func validateKey(inPath string) error {
+	if inPath == "" {
+		return errors.New("inPath is empty")
+	}
+	object, err := imgRefs().Parse(inPath)
+	if err != nil {
+		return fmt.Errorf("inPath %q: %s", inPath, err)
+	}
+	if strings.HasPrefix(object.Key, "/") {
+		return fmt.Errorf("inPath %q should not start with /", inPath)
+	}
+	for _, part := range strings.Split(object.Key, "/") {
+		if part == ".." {
+			return fmt.Errorf("inPath %q should not contain ..", inPath)
+		}
+	}
+	return nil
+}
+
+// 表格数据解析：首行可识别为表头时按表头映射，否则按列顺序解析且首行也是数据
+type tableParser struct {
+	aliases   map[string][]string
+	validator *Validator
+	mapping   *ColumnMapping
+	startRow  int
+	rejected  []Rejected
+}
+
+func newTableParser(startRow int) (*tableParser, error) {
+	validator, err := newValidator()
+	if err != nil {
+		return nil, err
+	}
+	return &tableParser{aliases: config.App().Pdl.Input.Columns, validator: validator, startRow: startRow}, nil
+}
+
+func newValidator() (*Validator, error) {
+	cfg := config.App().Pdl
+	return NewValidator(cfg.Input, cfg.Ocr)
+}
+
+// 依次传入每一行，row 为行号，返回通过校验的数据
+func (ths *tableParser) add(row int, cells []string) (LoanFile, bool, error) {
+	if ths.mapping == nil {
+		mapping, err := NewColumnMapping(cells, ths.aliases)
+		if err != nil {
+			return LoanFile{}, false, err
+		}
+		if mapping != nil {
+			ths.mapping = mapping
+			return LoanFile{}, false, nil
+		}
+		log.Warnf("No header found in row %d %v, parse by column order", row, cells)
+		ths.mapping = positionalMapping()
+	}
+	if row < ths.startRow || blank(cells) {
+		return LoanFile{}, false, nil
+	}
+	file, ok := ths.check(row, ths.mapping.LoanFile(cells))
+	return file, ok, nil
+}
+
+// 校验，未通过时记录
+func (ths *tableParser) check(row int, file LoanFile) (LoanFile, bool) {
+	file = normalizeLoanFile(file)
+	if err := ths.validator.Validate(file); err != nil {
+		ths.reject(row, err.Error(), file)
+		return file, false
+	}
+	return file, true
+}
+
+func (ths *tableParser) reject(row int, reason string, file LoanFile) {
+	ths.rejected = append(ths.rejected, Rejected{Row: row, Reason: reason, File: file})
+}
+
+func blank(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// 各数据来源共用：起始行和校验未通过的行
+type sourceBase struct {
+	startRow int
+	noReport bool
+	rejected []Rejected
+}
+
+func (ths *sourceBase) StartFrom(row int) {
+	ths.startRow = row
+}
+
+func (ths *sourceBase) SetReport(enabled bool) {
+	ths.noReport = !enabled
+}
+
+func (ths *sourceBase) Rejected() []Rejected {
+	return ths.rejected
+}
+
+// 记录校验未通过的行，input 不为空时在其旁边写入 <name>.rejected.csv
+// 没有校验未通过的行时不改动已有报告，续跑时跳过的行可能在其中
+func (ths *sourceBase) report(src Source, input string, rejected []Rejected) {
+	ths.rejected = rejected
+	if len(rejected) == 0 {
+		return
+	}
+	log.Warnf("%s 校验未通过 %d 行", src, len(rejected))
+	if ths.noReport {
+		return
+	}
+	if input == "" {
+		for _, r := range rejected {
+			log.Warnf("  row %d %s: %s", r.Row, r.File.CustNo, r.Reason)
+		}
+		return
+	}
+	filename := rejectedReportPath(input)
+	if err := WriteRejectedReport(filename, rejected); err != nil {
+		log.Errorf("Write rejected report %s err: %s", filename, err)
+		return
+	}
+	log.Warnf("校验未通过的行见 %s", filename)
+}
+
+func rejectedReportPath(input string) string {
+	return strings.TrimSuffix(input, filepath.Ext(input)) + ".rejected.csv"
+}
+
+// 写入校验未通过的行
+func WriteRejectedReport(filename string, rejected []Rejected) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	_ = writer.Write([]string{"row", "reason", ColCustNo, ColBusiType, ColInPath, ColAppNo, ColPhoneNo, ColHolderName})
+	for _, r := range rejected {
+		_ = writer.Write([]string{strconv.Itoa(r.Row), r.Reason,
+			r.File.CustNo, r.File.BusiType, r.File.InPath, r.File.AppNo, r.File.PhoneNo, r.File.HolderName})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,208 @@
+package loan
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+	uuid "github.com/satori/go.uuid"
+)
+
+// 任务状态
+const (
+	JobPending   = "PENDING"   // 待处理
+	JobInFlight  = "IN_FLIGHT" // 处理中
+	JobSucceeded = "SUCCEEDED" // 成功
+	JobFailed    = "FAILED"    // 失败，可重试
+	JobSkipped   = "SKIPPED"   // 永久失败，不再重试
+)
+
+// OCR 任务台账，每个客户每个业务类型一条，用于中断后续跑
+type OcrJob struct {
+	Id            string    `json:"id" gorm:"primary_key;type:varchar(40);comment:'ID'"`
+	InstTime      time.Time `json:"instTime" gorm:"column:INST_TIME;type:datetime;comment:'插入时间'"`
+	UpdtTime      time.Time `json:"updtTime" gorm:"column:UPDT_TIME;type:datetime;comment:'修改时间'"`
+	CustNo        string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);unique_index:uk_job_cust_busi;comment:'客户唯一编码'"`
+	BusiType      string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(40);unique_index:uk_job_cust_busi;comment:'业务类型（码类：1007）'"`
+	InPath        string    `json:"inPath" gorm:"column:IN_PATH;type:varchar(400);comment:'图片路径'"`
+	Status        string    `json:"status" gorm:"column:STATUS;type:varchar(16);index:idx_job_status;comment:'任务状态'"`
+	Attempts      int       `json:"attempts" gorm:"column:ATTEMPTS;type:int;comment:'尝试次数'"`
+	LastCode      string    `json:"lastCode" gorm:"column:LAST_CODE;type:varchar(200);comment:'最后一次ADV返回code'"`
+	LastError     string    `json:"lastError" gorm:"column:LAST_ERROR;type:varchar(400);comment:'最后一次错误'"`
+	TransactionId string    `json:"transactionId" gorm:"column:TRANSACTION_ID;type:varchar(80);comment:'ADV响应的transactionId'"`
+}
+
+func (OcrJob) TableName() string {
+	return "pdl_ocr_job"
+}
+
+// OCR 调用明细，每次 HTTP 请求一条，用于统计单个客户的收费次数
+type OcrAttempt struct {
+	Id            string    `json:"id" gorm:"primary_key;type:varchar(40);comment:'ID'"`
+	InstTime      time.Time `json:"instTime" gorm:"column:INST_TIME;type:datetime;comment:'插入时间'"`
+	CustNo        string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);index:idx_attempt_cust;comment:'客户唯一编码'"`
+	BusiType      string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(40);comment:'业务类型（码类：1007）'"`
+	AttemptNo     int       `json:"attemptNo" gorm:"column:ATTEMPT_NO;type:int;comment:'第几次调用'"`
+	RequestTime   time.Time `json:"requestTime" gorm:"column:REQUEST_TIME;type:datetime;comment:'调用时间'"`
+	ResponseTime  time.Time `json:"responseTime" gorm:"column:RESPONSE_TIME;type:datetime;comment:'响应时间'"`
+	HttpStatus    int       `json:"httpStatus" gorm:"column:HTTP_STATUS;type:int;comment:'HTTP状态码'"`
+	AdvCode       string    `json:"advCode" gorm:"column:ADV_CODE;type:varchar(200);comment:'ADV返回code'"`
+	TransactionId string    `json:"transactionId" gorm:"column:TRANSACTION_ID;type:varchar(80);comment:'ADV响应的transactionId'"`
+	IsPay         string    `json:"isPay" gorm:"column:IS_PAY;type:varchar(8);comment:'是否收费（码类：1000）'"`
+	Error         string    `json:"error" gorm:"column:ERROR;type:varchar(400);comment:'错误信息'"`
+}
+
+func (OcrAttempt) TableName() string {
+	return "pdl_ocr_attempt"
+}
+
+func jobKey(custNo string, busiType string) string {
+	return custNo + "|" + busiType
+}
+
+// 是否已结束（成功或永久失败）
+func (ths *OcrJob) Done() bool {
+	return ths.Status == JobSucceeded || ths.Status == JobSkipped
+}
+
+// 开始调用前标记，落库后中断时可知哪些请求已发出
+func (ths *OcrJob) MarkInFlight() {
+	ths.Attempts++
+	ths.Status = JobInFlight
+}
+
+func (ths *OcrJob) MarkSucceeded(code string, transactionId string) {
+	ths.Status = JobSucceeded
+	ths.LastCode = code
+	ths.LastError = ""
+	ths.TransactionId = transactionId
+}
+
+// permanent 为 true 时标记为跳过，后续批次不再重试
+func (ths *OcrJob) MarkFailed(code string, transactionId string, err string, permanent bool) {
+	ths.Status = JobFailed
+	if permanent {
+		ths.Status = JobSkipped
+	}
+	ths.LastCode = code
+	ths.LastError = truncate(err, 400)
+	if transactionId != "" {
+		ths.TransactionId = transactionId
+	}
+}
+
+// 任务状态落库，首次保存时新建
+func (ths *Service) saveJob(job *OcrJob) {
+	job.UpdtTime = time.Now()
+	if job.Id == "" {
+		job.Id = uuid.Must(uuid.NewV4(), nil).String()
+		job.InstTime = job.UpdtTime
+		if err := ths.repos.Jobs.Create(job); err != nil {
+			log.Errorf("Create ocr job %s err: %s", job.CustNo, err)
+		}
+		return
+	}
+	if err := ths.repos.Jobs.Update(job); err != nil {
+		log.Errorf("Save ocr job %s err: %s", job.CustNo, err)
+	}
+}
+
+// 加载任务台账，上次中断时处理中的任务重置为待处理
+func (ths *Service) LoadOcrJobs() map[string]*OcrJob {
+	jobMap := ths.loadOcrJobs()
+	interrupted := 0
+	for _, job := range jobMap {
+		if job.Status == JobInFlight {
+			job.Status = JobPending
+			interrupted++
+		}
+	}
+
+	if interrupted > 0 {
+		if err := ths.repos.Jobs.ResetInFlight(time.Now()); err != nil {
+			log.Errorf("Reset interrupted ocr jobs err: %s", err)
+		}
+		log.Infof("恢复中断任务数 %d", interrupted)
+	}
+	return jobMap
+}
+
+// 只读加载任务台账
+func (ths *Service) loadOcrJobs() map[string]*OcrJob {
+	jobMap, err := ths.repos.Jobs.All()
+	if err != nil {
+		log.Errorf("Load ocr jobs err: %s", err)
+		return make(map[string]*OcrJob)
+	}
+	return jobMap
+}
+
+// 获取任务，不存在则新建待处理任务（首次调用时落库）
+func jobFor(jobs map[string]*OcrJob, file *LoanFile) *OcrJob {
+	key := jobKey(file.CustNo, file.BusiType)
+	if job, ok := jobs[key]; ok {
+		job.InPath = file.InPath
+		return job
+	}
+	job := &OcrJob{
+		CustNo:   file.CustNo,
+		BusiType: file.BusiType,
+		InPath:   file.InPath,
+		Status:   JobPending,
+	}
+	jobs[key] = job
+	return job
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	// 不截断多字节字符
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// 保存调用明细
+func (ths *Service) SaveOcrAttempts(file *LoanFile, attempts []ocr.Attempt) {
+	paid := 0
+	for _, attempt := range attempts {
+		// 未发出的请求不记录
+		if attempt.RequestTime.IsZero() {
+			continue
+		}
+		isPay := "10000000"
+		if attempt.Paid {
+			isPay = "10000001"
+			paid++
+		}
+		record := OcrAttempt{
+			Id:            uuid.Must(uuid.NewV4(), nil).String(),
+			InstTime:      time.Now(),
+			CustNo:        file.CustNo,
+			BusiType:      file.BusiType,
+			AttemptNo:     attempt.No,
+			RequestTime:   attempt.RequestTime,
+			ResponseTime:  attempt.ResponseTime,
+			HttpStatus:    attempt.HttpStatus,
+			AdvCode:       attempt.Code,
+			TransactionId: attempt.TransactionId,
+			IsPay:         isPay,
+			Error:         truncate(attempt.Err, 400),
+		}
+		if err := ths.repos.Attempts.Add(&record); err != nil {
+			log.Errorf("Create ocr attempt %s err: %s", file.CustNo, err)
+		}
+	}
+	if paid > 1 {
+		log.Warnf("客户 %s 收费调用 %d 次", file.CustNo, paid)
+	}
+}
+
+// 某时间之后发出的调用次数，用于恢复每日调用上限的计数
+func (ths *Service) CountOcrAttemptsSince(since time.Time) (int, error) {
+	return ths.repos.Attempts.CountSince(since)
+}
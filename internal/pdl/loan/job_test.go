@@ -0,0 +1,22 @@
+package loan_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+)
+
+func TestMarkFailedTruncatesRunes(t *testing.T) {
+	var job loan.OcrJob
+	job.MarkFailed("ERROR", "", "a"+strings.Repeat("विफल", 100), false)
+	if !utf8.ValidString(job.LastError) || len(job.LastError) > 400 || len(job.LastError) < 398 {
+		t.Errorf("unexpected last error %d bytes, valid %t", len(job.LastError), utf8.ValidString(job.LastError))
+	}
+
+	job.MarkFailed("ERROR", "", strings.Repeat("识别失败", 50), false)
+	if !utf8.ValidString(job.LastError) || len(job.LastError) != 399 {
+		t.Errorf("unexpected last error %q", job.LastError)
+	}
+}
@@ -1,23 +1,23 @@
 package loan
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jinzhu/gorm"
 	"github.com/onlythinking/pug-go/internal/config"
-	"github.com/onlythinking/pug-go/internal/pdl/advance"
+	"github.com/onlythinking/pug-go/internal/pdl/imgprep"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	"github.com/onlythinking/pug-go/internal/pdl/verify"
 	log "github.com/onlythinking/pug-go/pkg/logging"
 	"github.com/onlythinking/pug-go/pkg/model"
-	"github.com/onlythinking/pug-go/pkg/oss/pugaws"
+	"github.com/onlythinking/pug-go/pkg/redact"
 	uuid "github.com/satori/go.uuid"
-	"github.com/tealeg/xlsx/v3"
 	"io/ioutil"
-	"net/http"
-	"path/filepath"
-	"strconv"
-	"strings"
+	"os"
+	"path"
+	"sync"
 	"time"
 )
 
@@ -27,6 +27,9 @@ type LoanFile struct {
 	InPath   string `json:"inPath"`
 	AppNo    string `json:"appNo"`
 	PhoneNo  string `json:"phoneNo"`
+
+	// 已有的客户姓名，用于与识别姓名比对，可为空
+	HolderName string `json:"holderName"`
 }
 
 type CuCustOcrResultDtl struct {
@@ -36,14 +39,26 @@ type CuCustOcrResultDtl struct {
 	InstUserNo string    `json:"instUserNo" gorm:"column:INST_USER_NO;type:varchar(40);comment:'插入用户编码'"`
 	UpdtUserNo string    `json:"updtUserNo" gorm:"column:UPDT_USER_NO;type:varchar(40);comment:'修改用户编码'"`
 	Remark     string    `json:"REMARK" gorm:"column:REMARK;type:varchar(400);comment:'备注（修改记录）'"`
-	CustNo     string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);comment:'客户唯一编码'"`
-	BusiType   string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(8);comment:'业务类型（码类：1007）'"`
+	CustNo     string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);unique_index:uk_ocr_cust_busi;comment:'客户唯一编码'"`
+	BusiType   string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(40);unique_index:uk_ocr_cust_busi;comment:'业务类型（码类：1007）'"`
 	AdvCode    string    `json:"advCode" gorm:"column:ADV_CODE;type:varchar(200);comment:'ADV返回code'"`
 	Message    string    `json:"message" gorm:"column:MESSAGE;type:varchar(200);comment:'ADV返回message'"`
-	PanNo      string    `json:"panNo" gorm:"column:PAN_NO;type:varchar(40);comment:'Pan卡编号'"`
-	CustName   string    `json:"custName" gorm:"column:CUST_NAME;type:varchar(500);comment:'客户姓名'"`
-	Birthday   string    `json:"birthday" gorm:"column:BIRTHDAY;type:varchar(40);comment:'生日'"`
-	FatherName string    `json:"fatherName" gorm:"column:FATHER_NAME;type:varchar(500);comment:'父亲姓名'"`
+	PanNo      string    `json:"panNo" gorm:"column:PAN_NO;type:varchar(200);comment:'Pan卡编号（加密）'"`
+	CustName   string    `json:"custName" gorm:"column:CUST_NAME;type:varchar(500);comment:'客户姓名（加密）'"`
+	Birthday   string    `json:"birthday" gorm:"column:BIRTHDAY;type:varchar(200);comment:'生日（加密）'"`
+	FatherName string    `json:"fatherName" gorm:"column:FATHER_NAME;type:varchar(500);comment:'父亲姓名（加密）'"`
+	CardType   string    `json:"cardType" gorm:"column:CARD_TYPE;type:varchar(40);comment:'证件类型'"`
+	Gender     string    `json:"gender" gorm:"column:GENDER;type:varchar(20);comment:'性别'"`
+	Address    string    `json:"address" gorm:"column:ADDRESS;type:text;comment:'地址（加密）'"`
+	ExtraInfo  string    `json:"extraInfo" gorm:"column:EXTRA_INFO;type:text;comment:'证件其他字段（JSON，加密）'"`
+
+	// 校验结果，见 verify.StatusValid 等，识别失败时为空
+	BirthDate     *time.Time `json:"birthDate" gorm:"-"`
+	VerifyStatus  string     `json:"verifyStatus" gorm:"column:VERIFY_STATUS;type:varchar(20);index:idx_ocr_verify_status;comment:'校验状态'"`
+	VerifyMessage string     `json:"verifyMessage" gorm:"column:VERIFY_MESSAGE;type:varchar(400);comment:'校验未通过原因'"`
+
+	// BirthDate 落库的形式，由 BeforeSave 生成
+	BirthDateText string `json:"-" gorm:"column:BIRTH_DATE;type:varchar(200);comment:'解析后的出生日期（yyyy-MM-dd，加密）'"`
 }
 
 type PointThirdServiceRecord struct {
@@ -73,301 +88,498 @@ func (PointThirdServiceRecord) TableName() string {
 	return "point_third_service_record"
 }
 
-//*************** https://gorm.io/docs ******************************
-var dbTp *gorm.DB
-var downloader *pugaws.S3Downloader
-var advClient *advance.AdvClient
-
-func Init(db *gorm.DB, d *pugaws.S3Downloader, client *advance.AdvClient) {
-	dbTp = db
-	downloader = d
-	advClient = client
-}
-
-func BatchDownloadImg(excelPath string) {
-
-	allItems, err := ParseExcel(excelPath)
-	if err != nil {
-		log.Error("ParseExcel err : ", err)
-		return
+// 按模型创建或补全表结构，用于测试和本地开发，MySQL 表结构由 pdl migrate 维护
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&OcrResultHistory{}).Error; err != nil {
+		return err
 	}
+	if err := dedupeOcrResults(db); err != nil {
+		return err
+	}
+	return db.AutoMigrate(&CuCustOcrResultDtl{}, &PointThirdServiceRecord{}, &OcrJob{}, &OcrAttempt{}, &OcrImageCache{}, &EventOutbox{}).Error
+}
 
-	items := allItems[1:]
+func (ths *Service) BatchDownloadImg(ctx context.Context, src Source) Summary {
 
 	baseDir := config.App().Pdl.BaseDir
-	chunkSize := config.App().Pdl.ChunkSize
-	asyncSize := config.App().Pdl.AsyncSize
+	pipelineCfg := config.App().Pdl.Pipeline
 
-	var chunks [][]LoanFile
-	for chunkSize < len(items) {
-		items, chunks = items[chunkSize:], append(chunks, items[0:chunkSize:chunkSize])
+	log.Infof("开始下载 %s", src)
+
+	tasks, wait := TasksFrom(ctx, src, nil, pipelineCfg.QueueSize, config.App().Pdl.ChunkSize)
+	summary := newPipeline().
+		Stage("download", stageWorkers(pipelineCfg.DownloadWorkers), ths.DownloadImg(baseDir)).
+		Run(ctx, tasks)
+	if err := wait(); err != nil {
+		log.Errorf("Read %s err: %s", src, err)
 	}
-	chunks = append(chunks, items)
 
-	for index, chunk := range chunks {
-		log.Infof("--------开始处理【%s】---------", strconv.Itoa(index))
+	logSummary("下载", summary)
+	return summary
+}
 
-		start := time.Now()
+func (ths *Service) BatchReqAdvIdCardOcr(ctx context.Context, src Source) Summary {
+	return ths.batchOcr(ctx, src, false, false)
+}
 
-		itemChunk := chunk
+// 逐条下载后立即识别，inMemory 为 true 时图片不落盘
+// 本地已有图片时不再下载
+func (ths *Service) BatchDownloadAndOcr(ctx context.Context, src Source, inMemory bool) Summary {
+	return ths.batchOcr(ctx, src, true, inMemory)
+}
 
-		var asyncChunks [][]LoanFile
-		for asyncSize < len(itemChunk) {
-			itemChunk, asyncChunks = itemChunk[asyncSize:], append(asyncChunks, items[0:asyncSize:asyncSize])
-		}
-		asyncChunks = append(asyncChunks, itemChunk)
+// 边读取边处理，fetch 为 true 时在识别前增加下载阶段
+// 相同内容的图片只识别一次，其他客户复用识别结果
+func (ths *Service) batchOcr(ctx context.Context, src Source, fetch bool, inMemory bool) Summary {
+	baseDir := config.App().Pdl.BaseDir
+	pipelineCfg := config.App().Pdl.Pipeline
+	cache := NewImageCache(ths.repos.Images)
+
+	//已处理（台账之前的历史成功结果）
+	processedMap := ths.processedResults()
+	// 任务台账
+	jobs := ths.LoadOcrJobs()
+	// 需要处理的客户编号
+	pending := newPendingFilter(processedMap, jobs)
 
-		// 等待批次完成
-		countDown := make(chan int, len(asyncChunks))
+	log.Infof("开始处理 %s", src)
 
-		for _, asyncItem := range asyncChunks {
-			asyncItem := asyncItem
-			go func() {
-				DownloadImg(baseDir, &asyncItem)
-				countDown <- 1
-			}()
-		}
+	// 余额不足或达到每日上限时停止整个批次
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
 
-		<-countDown
+	// 埋点先落库，后台发送，结束时发送剩余记录
+	events := ths.NewEventSender()
+	events.Start(ctx)
 
-		log.Infof("下载完成 【%s】", strconv.Itoa(index))
-		log.Infof("耗时 %d ms", time.Since(start).Milliseconds())
-		log.Info("--------处理结束---------")
+	pipeline := newPipeline()
+	defer events.Close(pipeline.drainTimeout)
+	if fetch {
+		pipeline.Stage("download", stageWorkers(pipelineCfg.DownloadWorkers), ths.FetchImg(baseDir, inMemory, cache))
+	}
+	if preprocessCfg := config.App().Pdl.Preprocess; preprocessCfg.Enabled {
+		preprocessor := imgprep.NewPreprocessor(preprocessCfg)
+		pipeline.Stage("preprocess", preprocessor.Workers, PreprocessImg(baseDir, preprocessor))
+	}
+	tasks, wait := TasksFrom(ctx, src, pending.accept, pipelineCfg.QueueSize, config.App().Pdl.ChunkSize)
+	summary := pipeline.
+		Stage("ocr", stageWorkers(pipelineCfg.OcrWorkers), abortOnQuota(ths.ReqIdCardOcr(baseDir, cache), abort)).
+		FinalStage("persist", stageWorkers(pipelineCfg.PersistWorkers), ths.SaveOcrResult(events)).
+		Run(ctx, tasks)
+	if err := wait(); err != nil {
+		log.Errorf("Read %s err: %s", src, err)
 	}
 
+	log.Info("----------------")
+	log.Info("数据读取情况: ")
+	log.Infof("已处理数 %d ", pending.done)
+	log.Infof("重复数 %d", len(pending.duplicates))
+	log.Infof("待处理数 %d", pending.pending)
+	log.Infof("总数 %d", pending.total)
+	log.Infof("校验未通过数 %d", len(src.Rejected()))
+	log.Infof("复用相同图片识别结果数 %d", cache.Hits())
+	log.Info("----------------")
+
+	logSummary("OCR", summary)
+	return summary
 }
 
-func BatchReqAdvIdCardOcr(excelPath string) {
-	all, err := ParseExcel(excelPath)
-	if err != nil {
-		log.Error("ParseExcel err : ", err)
-		return
-	}
+// 待处理数据过滤：跳过已完成（成功或永久失败）和重复的数据，为待处理数据建立台账
+// 只在读取协程中调用
+type pendingFilter struct {
+	processedMap map[string]string
+	jobs         map[string]*OcrJob
+	queued       map[string]bool
+	total        int
+	done         int
+	pending      int
+	duplicates   []LoanFile
+}
 
-	loans := all[1:]
+func newPendingFilter(processedMap map[string]string, jobs map[string]*OcrJob) *pendingFilter {
+	return &pendingFilter{processedMap: processedMap, jobs: jobs, queued: make(map[string]bool)}
+}
 
-	baseDir := config.App().Pdl.BaseDir
-	chunkSize := config.App().Pdl.ChunkSize
-	asyncSize := config.App().Pdl.AsyncSize
+// 需要处理时关联任务台账并返回 true
+func (ths *pendingFilter) accept(task *Task) bool {
+	ths.total++
+	loan := task.File
+	key := jobKey(loan.CustNo, loan.BusiType)
+	if ths.queued[key] {
+		ths.duplicates = append(ths.duplicates, loan)
+		return false
+	}
+	job, exist := ths.jobs[key]
+	if exist && job.Done() {
+		ths.done++
+		return false
+	}
+	if _, processed := ths.processedMap[key]; processed && !exist {
+		ths.done++
+		return false
+	}
+	task.Job = jobFor(ths.jobs, &task.File)
+	ths.queued[key] = true
+	ths.pending++
+	return true
+}
 
-	//已处理
-	processedMap := GetAllOcrResult()
-	// 需要处理的客户编号
-	var items []LoanFile
-	for _, loan := range loans {
-		_, exist := processedMap[loan.CustNo]
-		if exist {
-			continue
-		}
-		items = append(items, loan)
+func newPipeline() *Pipeline {
+	cfg := config.App().Pdl
+	drainTimeout := time.Duration(cfg.Pipeline.DrainTimeout) * time.Second
+	if drainTimeout <= 0 {
+		drainTimeout = 30 * time.Second
+	}
+	return NewPipeline(cfg.Pipeline.QueueSize, cfg.ChunkSize, drainTimeout)
+}
+
+// 阶段并发数，未配置时使用 asyncSize
+func stageWorkers(workers int) int {
+	if workers > 0 {
+		return workers
 	}
+	return config.App().Pdl.AsyncSize
+}
 
+func logSummary(what string, summary Summary) {
 	log.Info("----------------")
-	log.Info("数据整理完毕: ")
-	log.Infof("已处理数 %d ", len(processedMap))
-	log.Infof("待处理数 %d", len(items))
-	log.Infof("总数 %d", len(loans))
+	if summary.Interrupted {
+		log.Warnf("%s已中断，未处理的任务下次运行时继续", what)
+	}
+	log.Infof("%s完成 总数 %d 成功 %d 失败 %d 未处理 %d", what, summary.Total, summary.Succeeded, summary.Failed, summary.Skipped)
+	log.Infof("耗时 %d ms", summary.Elapsed.Milliseconds())
 	log.Info("----------------")
+}
 
-	var chunks [][]LoanFile
-	for chunkSize < len(items) {
-		items, chunks = items[chunkSize:], append(chunks, items[0:chunkSize:chunkSize])
+// 下载阶段
+func (ths *Service) DownloadImg(baseDir string) StageFunc {
+	return func(ctx context.Context, task *Task) error {
+		err := ths.downloader.BatchDownload(ctx, baseDir, []string{task.File.InPath})
+		if err != nil {
+			log.Error("download loan img err ", err)
+		}
+		return err
 	}
-	chunks = append(chunks, items)
-
-	for index, chunk := range chunks {
-		log.Infof("--------开始处理【%s】---------", strconv.Itoa(index))
+}
 
-		start := time.Now()
+// 识别前的下载阶段，本地已有图片时跳过，inMemory 为 true 时下载到 task.Image
+// 下载器可提供 ETag 时先按 ETag 查询识别结果缓存，命中则不再下载
+func (ths *Service) FetchImg(baseDir string, inMemory bool, cache *ImageCache) StageFunc {
+	download := ths.DownloadImg(baseDir)
+	return func(ctx context.Context, task *Task) error {
+		if hasLocalImg(imgPath(baseDir, task.File.InPath)) {
+			return nil
+		}
+		if cache != nil && ths.cachedByETag(ctx, cache, task) {
+			return nil
+		}
+		if !inMemory {
+			return download(ctx, task)
+		}
+		image, err := ths.downloader.Download(ctx, task.File.InPath)
+		if err != nil {
+			log.Errorf("download loan img %s err: %s", task.File.InPath, err)
+			return err
+		}
+		task.Image = image
+		return nil
+	}
+}
 
-		itemChunk := chunk
+// 按 ETag 命中缓存时记录摘要，识别阶段直接复用结果
+func (ths *Service) cachedByETag(ctx context.Context, cache *ImageCache, task *Task) bool {
+	lookup, ok := ths.downloader.(ETagLookup)
+	if !ok {
+		return false
+	}
+	etag, err := lookup.ETag(ctx, task.File.InPath)
+	if err != nil {
+		log.Debugf("head loan img %s err: %s", task.File.InPath, err)
+		return false
+	}
+	hash, ok := etagHash(etag)
+	if !ok || cache.Lookup(hash, ths.providers.CardType(task.File.BusiType)) == nil {
+		return false
+	}
+	task.Hash = hash
+	return true
+}
 
-		var asyncChunks [][]LoanFile
-		for asyncSize < len(itemChunk) {
-			itemChunk, asyncChunks = itemChunk[asyncSize:], append(asyncChunks, items[0:asyncSize:asyncSize])
+// 预处理阶段，处理后的图片放在 task.Image 中上传，不修改本地图片
+// 处理前记录原图摘要，保证与 ETag 和未预处理时的缓存一致
+func PreprocessImg(baseDir string, preprocessor *imgprep.Preprocessor) StageFunc {
+	return func(ctx context.Context, task *Task) error {
+		if task.Image == nil {
+			filename := imgPath(baseDir, task.File.InPath)
+			// 已按 ETag 命中缓存，未下载
+			if task.Hash != "" && !hasLocalImg(filename) {
+				return nil
+			}
+			image, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			task.Image = image
 		}
-		asyncChunks = append(asyncChunks, itemChunk)
-
-		// 等待批次完成
-		countDown := make(chan int, len(asyncChunks))
+		if task.Hash == "" {
+			task.Hash = imageHash(task.Image)
+		}
+		image, err := preprocessor.Process(task.Image)
+		if err != nil {
+			task.Image = nil
+			log.Warnf("客户 %s 图片 %s 未提交识别: %s", task.File.CustNo, task.File.InPath, err)
+			return err
+		}
+		task.Image = image
+		return nil
+	}
+}
 
-		for _, asyncItem := range asyncChunks {
-			asyncItem := asyncItem
+// 本地图片存在且不为空（中断的下载会留下空文件）
+func hasLocalImg(filename string) bool {
+	fi, err := os.Stat(filename)
+	return err == nil && fi.Size() > 0
+}
 
-			go func() {
-				for _, aItem := range asyncItem {
-					time.Sleep(time.Millisecond * 20)
-					ReqAdvIdCardOcr(baseDir, &aItem)
+// OCR 阶段，按业务类型选择服务商
+// 任务带有内存图片时直接上传，否则读取 baseDir 下的本地图片
+// cache 不为空时相同内容的图片只识别一次
+func (ths *Service) ReqIdCardOcr(baseDir string, cache *ImageCache) StageFunc {
+	return func(ctx context.Context, task *Task) error {
+		provider := ths.providers.For(task.File.BusiType)
+		cardType := ths.providers.CardType(task.File.BusiType)
+
+		if cache != nil {
+			hash := task.Hash
+			if hash == "" {
+				hash = taskImageHash(baseDir, task)
+			}
+			if hash != "" {
+				result, owner, err := cache.acquire(ctx, hash, cardType)
+				if err != nil {
+					return err
 				}
-				countDown <- 1
-			}()
+				if !owner {
+					log.Infof("客户 %s 复用相同图片的识别结果 %s", task.File.CustNo, result.Code)
+					task.Image = nil
+					task.Result = result
+					task.Cached = true
+					return nil
+				}
+				task.Hash = hash
+				defer func() { cache.release(hash, cardType, &task.File, task.Result) }()
+			}
 		}
 
-		<-countDown
-
-		log.Infof("下载完成 【%s】", strconv.Itoa(index))
-		log.Infof("耗时 %d ms", time.Since(start).Milliseconds())
-		log.Info("--------处理结束---------")
+		task.Job.MarkInFlight()
+		ths.saveJob(task.Job)
+
+		var result *ocr.Result
+		var err error
+		if task.Image != nil {
+			recognizer, ok := provider.(ocr.ImageRecognizer)
+			if !ok {
+				return fmt.Errorf("%s does not support in-memory image", provider.Name())
+			}
+			result, err = recognizer.RecognizeImage(ctx, path.Base(task.File.InPath), task.Image, cardType)
+			// 识别后释放图片
+			task.Image = nil
+		} else {
+			result, err = provider.Recognize(ctx, imgPath(baseDir, task.File.InPath), cardType)
+		}
+		task.Result = result
+		if err != nil {
+			log.Errorf("ReqIdCardOcr %s %s err: %s", provider.Name(), task.File.CustNo, err)
+			return err
+		}
+		return nil
 	}
-
 }
 
-func DownloadImg(baseDir string, files *[]LoanFile) {
-	var keys []string
-	for _, v := range *files {
-		keys = append(keys, v.InPath)
+// 内存图片或本地图片的摘要，无法读取时返回空，不复用结果
+func taskImageHash(baseDir string, task *Task) string {
+	if task.Image != nil {
+		return imageHash(task.Image)
 	}
-	err := downloader.BatchDownload(baseDir, keys)
+	hash, err := fileHash(imgPath(baseDir, task.File.InPath))
 	if err != nil {
-		log.Error("download loan img err ", err)
+		return ""
 	}
+	return hash
 }
 
-func ReqAdvIdCardOcr(baseDir string, file *LoanFile) {
-	data, err := advClient.ReqIdCardOcr(filepath.Join(baseDir, file.InPath))
-	advResp := advance.AdvResp{}
-	err = json.Unmarshal(data, &advResp)
-
-	if err != nil {
-		log.Errorf("ReqAdvIdCardOcr to json err: %s ", string(data), err)
-		return
+// OCR 额度耗尽时取消批次，已调度的任务保持原状态等待下次运行
+func abortOnQuota(fn StageFunc, abort context.CancelFunc) StageFunc {
+	return func(ctx context.Context, task *Task) error {
+		err := fn(ctx, task)
+		if ocr.IsQuotaExhausted(err) || (task.Result != nil && task.Result.Exhausted) {
+			log.Error("OCR quota exhausted, abort batch")
+			abort()
+		}
+		return err
 	}
+}
 
-	ocrResult := CuCustOcrResultDtl{
-		BusiType:   file.BusiType,
-		AdvCode:    advResp.Code,
-		Message:    advResp.Message,
-		CustNo:     file.CustNo,
-		PanNo:      advResp.Data.Values.IdNumber,
-		CustName:   advResp.Data.Values.Name,
-		Birthday:   advResp.Data.Values.Birthday,
-		FatherName: advResp.Data.Values.FatherName,
-	}
+// 落库阶段：保存结果、更新台账并写入埋点发件箱
+func (ths *Service) SaveOcrResult(events *EventSender) StageFunc {
+	return func(ctx context.Context, task *Task) error {
+		file := &task.File
+		job := task.Job
 
-	ocrResult.InsertOcrResult()
+		if task.Result != nil {
+			ths.SaveOcrAttempts(file, task.Result.Attempts)
+		}
 
-	var isPay = "10000000"
-	if "PAY" == advResp.PricingStrategy {
-		isPay = "10000001"
-	}
-	reqPoint := PointThirdServiceRecord{
-		AppNo:           file.CustNo[1:4],
-		TransactionId:   advResp.TransactionId,
-		ServiceName:     "PAN OCR",
-		InstUserNo:      "sys",
-		ResponseStatus:  "10000001",
-		ResponseCode:    advResp.Code,
-		ResponseMessage: advResp.Message,
-		RequestTime:     model.JsonTime(time.Now()),
-		ResponseTime:    model.JsonTime(time.Now()),
-		IsPay:           isPay,
-		Remark:          string(data),
-	}
+		if task.Err != nil {
+			// 中断且未发出请求的任务保持原状态
+			if errors.Is(task.Err, ErrInterrupted) && job.Status != JobInFlight {
+				return nil
+			}
+			// 不符合要求的图片记录为永久失败
+			if imgprep.IsRejected(task.Err) {
+				job.MarkFailed(imgprep.RejectedCode, "", task.Err.Error(), true)
+			} else {
+				job.MarkFailed("", "", task.Err.Error(), false)
+			}
+			ths.saveJob(job)
+			return nil
+		}
 
-	reqPointData, err := json.Marshal(reqPoint)
-	if err != nil {
-		log.Errorf("ReqOrcRecord to json err %s", err)
-		return
-	}
-	go WriteReqOcrRecord(string(reqPointData))
-}
+		result := task.Result
+		if result.Success {
+			job.MarkSucceeded(result.Code, result.TransactionId)
+		} else {
+			job.MarkFailed(result.Code, result.TransactionId, result.Message, result.Terminal)
+		}
+		ths.saveJob(job)
 
-func (ths CuCustOcrResultDtl) SqlTemplate() *gorm.DB {
-	return dbTp
-}
+		if err := ths.SaveResult(NewOcrResult(file, result)); err != nil {
+			log.Errorf("Save ocr result of %s err: %s", file.CustNo, err)
+		}
 
-func (ths CuCustOcrResultDtl) GenerateUUID() string {
-	return uuid.Must(uuid.NewV4(), nil).String()
-}
+		// 复用的结果没有调用三方服务，不上报埋点
+		if task.Cached {
+			return resultErr(result)
+		}
 
-func (ths CuCustOcrResultDtl) InsertOcrResult() {
-	dbTp := ths.SqlTemplate()
-	if "SUCCESS" != ths.AdvCode {
-		return
+		var isPay = "10000000"
+		if result.Paid {
+			isPay = "10000001"
+		}
+		reqPoint := PointThirdServiceRecord{
+			AppNo:           appNoOf(file.CustNo),
+			TransactionId:   result.TransactionId,
+			ServiceName:     serviceName(result.CardType),
+			InstUserNo:      "sys",
+			ResponseStatus:  "10000001",
+			ResponseCode:    result.Code,
+			ResponseMessage: result.Message,
+			RequestTime:     model.JsonTime(time.Now()),
+			ResponseTime:    model.JsonTime(time.Now()),
+			IsPay:           isPay,
+			// 原始响应中的证件号、姓名等遮盖后上报
+			Remark: string(redact.JSON(result.Raw)),
+		}
+
+		if err := ths.AddRecord(file, reqPoint); err != nil {
+			log.Errorf("Enqueue event of %s err: %s", file.CustNo, err)
+		} else {
+			events.Notify()
+		}
+
+		return resultErr(result)
 	}
-	ths.Id = ths.GenerateUUID()
-	ths.InstTime = time.Now()
-	ths.UpdtTime = time.Now()
-	dbTp.Create(ths)
 }
 
-func GetAllOcrResult() map[string]string {
-	var ocrResult []CuCustOcrResultDtl
-	dbTp.Find(&ocrResult)
-	dbTp.Model(&ocrResult)
-	if ocrResult != nil {
-		var processedMap = make(map[string]string, len(ocrResult))
-		for _, v := range ocrResult {
-			processedMap[v.CustNo] = v.AdvCode
-		}
-		return processedMap
+func resultErr(result *ocr.Result) error {
+	if !result.Success {
+		return fmt.Errorf("%s %s", result.Code, result.Message)
 	}
 	return nil
 }
 
-// 解析Excel
-func ParseExcel(filename string) ([]LoanFile, error) {
-	wb, err := xlsx.OpenFile(filename)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("%s file not exist.", filename))
-	}
-	sh := wb.Sheets[0]
-	log.Info("XLS Read num total:", sh.MaxRow)
+var (
+	verifierOnce sync.Once
+	verifier     *verify.Verifier
+)
 
-	var loanFiles []LoanFile
+// 识别结果校验，按 Pdl.Verify 创建
+func resultVerifier() *verify.Verifier {
+	verifierOnce.Do(func() {
+		verifier = verify.NewVerifier(config.App().Pdl.Verify)
+	})
+	return verifier
+}
 
-	for i := 0; i < sh.MaxRow; i++ {
-		row, err := sh.Row(i)
-		if err != nil {
-			log.Errorf("XLS row %s err: %s", i, err)
-			continue
+// EXTRA_INFO 中纠正误识别后的 PAN，PAN_NO 保留识别出的值
+const SuggestedPanKey = "suggestedPanNo"
+
+// 识别结果转换为客户 OCR 结果，识别成功时校验并归一化证件字段
+func NewOcrResult(file *LoanFile, result *ocr.Result) CuCustOcrResultDtl {
+	fields := result.Fields
+	var checked *verify.Result
+	if result.Success {
+		r := resultVerifier().Verify(result.CardType, fields, file.HolderName)
+		fields = r.Fields
+		checked = &r
+	}
+	ocrResult := CuCustOcrResultDtl{
+		BusiType:   file.BusiType,
+		AdvCode:    result.Code,
+		Message:    result.Message,
+		CustNo:     file.CustNo,
+		PanNo:      fields.IdNumber,
+		CustName:   fields.Name,
+		Birthday:   fields.Birthday,
+		FatherName: fields.FatherName,
+		CardType:   result.CardType,
+		Gender:     fields.Gender,
+		Address:    fields.Address,
+	}
+	if checked != nil && checked.SuggestedPan != "" {
+		// 纠正后的 PAN 只作为建议，和证件其他字段一起保存
+		extra := make(map[string]string, len(fields.Extra)+1)
+		for k, v := range fields.Extra {
+			extra[k] = v
 		}
-		custNoCell := row.GetCell(0)
-		custNo, _ := custNoCell.FormattedValue()
-		busiTypeCell := row.GetCell(1)
-		busiType, _ := busiTypeCell.FormattedValue()
-		inPathCell := row.GetCell(2)
-		inPath, _ := inPathCell.FormattedValue()
-		appNoCell := row.GetCell(3)
-		appNo, _ := appNoCell.FormattedValue()
-		phoneNoCell := row.GetCell(4)
-		phoneNo, _ := phoneNoCell.FormattedValue()
-		if inPath == "" {
-			continue
+		extra[SuggestedPanKey] = checked.SuggestedPan
+		fields.Extra = extra
+	}
+	if checked != nil {
+		ocrResult.BirthDate = checked.BirthDate
+		ocrResult.VerifyStatus = checked.Status
+		ocrResult.VerifyMessage = truncate(checked.Message(), 400)
+		if checked.Status != verify.StatusValid {
+			log.Warnf("OcrResult %s %s: %s", file.CustNo, checked.Status, checked.Message())
 		}
-		loanFiles = append(loanFiles, LoanFile{CustNo: custNo,
-			BusiType: busiType,
-			InPath:   strings.ReplaceAll(inPath, "https://qt-fpdl-app.s3.ap-south-1.amazonaws.com/", ""),
-			AppNo:    appNo,
-			PhoneNo:  phoneNo,
-		})
 	}
-	return loanFiles, nil
-}
-
-var pointUrl = config.App().Pdl.EventServer.ThirdUrl
-
-// 调用埋点
-func WriteReqOcrRecord(reqBody string) {
-	data := []byte(reqBody)
-	req, err := http.NewRequest("POST", pointUrl, bytes.NewBuffer(data))
-	if err != nil {
-		log.Errorf("ReqOrcRecord new request err: %s", err)
-		return
+	if len(fields.Extra) > 0 {
+		extra, err := json.Marshal(fields.Extra)
+		if err != nil {
+			log.Errorf("OcrResult extra to json err %s", err)
+		} else {
+			ocrResult.ExtraInfo = string(extra)
+		}
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return ocrResult
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Errorf("ReqOrcRecord req err: %s", err)
-		return
+// 埋点的 AppNo 为客户编号第 2 到 4 位，自定义 custNoPattern 允许更短的编号时为空
+func appNoOf(custNo string) string {
+	if len(custNo) < 4 {
+		return ""
 	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
+	return custNo[1:4]
+}
 
-	if resp.StatusCode != 200 {
-		log.Errorf("ReqOrcRecord return err: %s", string(body))
+// 三方服务名称
+func serviceName(cardType string) string {
+	if cardType == "" || cardType == ocr.PanFront {
+		return "PAN OCR"
 	}
+	return cardType + " OCR"
+}
 
+func (ths CuCustOcrResultDtl) GenerateUUID() string {
+	return uuid.Must(uuid.NewV4(), nil).String()
 }
@@ -0,0 +1,698 @@
+package loan_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mattn/go-sqlite3"
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/advance"
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/imgprep"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	"github.com/onlythinking/pug-go/internal/pdl/verify"
+	"github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/tealeg/xlsx/v3"
+)
+
+var (
+	baseDir      string
+	eventRecords int64
+)
+
+// gorm 建表语句带 MySQL 的 COMMENT，sqlite 不支持，测试驱动中去掉
+var commentPattern = regexp.MustCompile(`(?i)\s+COMMENT\s+'[^']*'`)
+
+type sqliteDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (ths *sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := ths.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn}, nil
+}
+
+type sqliteConn struct {
+	driver.Conn
+}
+
+func (ths *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return ths.Conn.Prepare(commentPattern.ReplaceAllString(query, ""))
+}
+
+func init() {
+	sql.Register("sqlite3_test", &sqliteDriver{})
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "loan-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	logging.SetLogFile(filepath.Join(dir, "app.log"))
+
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&eventRecords, 1)
+	}))
+	defer events.Close()
+
+	baseDir = filepath.Join(dir, "img")
+	cfg := fmt.Sprintf(`
+oss:
+  defaultBucket: qt-fpdl-app
+pdl:
+  baseDir: %s
+  chunkSize: 100
+  asyncSize: 2
+  pipeline:
+    queueSize: 4
+    ocrWorkers: 1
+    persistWorkers: 2
+    drainTimeout: 5
+  eventServer:
+    thirdUrl: %s
+`, baseDir, events.URL)
+	cfgPath := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(cfgPath, []byte(cfg), 0644); err != nil {
+		panic(err)
+	}
+	config.InitConfigFile(cfgPath)
+
+	return m.Run()
+}
+
+// 初始化 sqlite 数据库和 OCR 客户端
+func setup(t *testing.T, server *advancetest.Server) (*loan.Service, *gorm.DB) {
+	t.Helper()
+
+	// 事务开始即加写锁，避免并发事务读后升级写锁时直接返回 database is locked
+	sqlDB, err := sql.Open("sqlite3_test", "file:"+filepath.Join(t.TempDir(), "pdl.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("sqlite3", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return initClient(db, server, nil), db
+}
+
+func initClient(db *gorm.DB, server *advancetest.Server, downloader loan.Downloader) *loan.Service {
+	if err := loan.Migrate(db); err != nil {
+		panic(err)
+	}
+	return loan.NewService(loan.NewGormRepos(db), downloader, newSelector(server))
+}
+
+func newSelector(server *advancetest.Server) *ocr.Selector {
+	retry := advance.NewRetryPolicy(config.RetryConfig{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 5})
+	limiter := advance.NewLimiter(0, 1, 0, 10*time.Millisecond)
+	client := advance.NewAdvClient(server.URL, "test-key", ocr.PanFront, limiter, retry)
+	return ocr.NewSelector(client)
+}
+
+// 生成 Excel 和对应的本地图片
+func writeExcel(t *testing.T, custNos ...string) string {
+	t.Helper()
+
+	wb := xlsx.NewFile()
+	sh, err := wb.AddSheet("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addRow(sh, "custNo", "busiType", "inPath", "appNo", "phoneNo")
+	for _, custNo := range custNos {
+		inPath := filepath.Join(t.Name(), custNo+".jpg")
+		addRow(sh, custNo, "1", inPath, "001", "9876543210")
+
+		filename := filepath.Join(baseDir, inPath)
+		if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, fakeImage(inPath), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	excelPath := filepath.Join(t.TempDir(), "pan.xlsx")
+	if err := wb.Save(excelPath); err != nil {
+		t.Fatal(err)
+	}
+	return excelPath
+}
+
+func addRow(sh *xlsx.Sheet, values ...string) {
+	row := sh.AddRow()
+	for _, v := range values {
+		row.AddCell().SetString(v)
+	}
+}
+
+// 模拟 S3 下载，记录每个 key 的下载次数
+type fakeDownloader struct {
+	mu        sync.Mutex
+	downloads map[string]int
+	images    map[string][]byte // 指定 key 的图片内容
+}
+
+func newFakeDownloader() *fakeDownloader {
+	return &fakeDownloader{downloads: map[string]int{}, images: map[string][]byte{}}
+}
+
+func (ths *fakeDownloader) BatchDownload(ctx context.Context, baseDir string, keys []string) error {
+	for _, key := range keys {
+		image, err := ths.Download(ctx, key)
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(baseDir, key)
+		if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, image, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ths *fakeDownloader) Download(ctx context.Context, key string) ([]byte, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	ths.downloads[key]++
+	return ths.image(key), nil
+}
+
+func (ths *fakeDownloader) image(key string) []byte {
+	if image, ok := ths.images[key]; ok {
+		return image
+	}
+	return fakeImage(key)
+}
+
+// 每个 key 的图片内容不同，避免被当作相同图片复用识别结果
+func fakeImage(key string) []byte {
+	return []byte("fake image " + filepath.ToSlash(key))
+}
+
+func (ths *fakeDownloader) count(key string) int {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	return ths.downloads[key]
+}
+
+func jobStatus(t *testing.T, db *gorm.DB) map[string]loan.OcrJob {
+	t.Helper()
+
+	var jobs []loan.OcrJob
+	if err := db.Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]loan.OcrJob, len(jobs))
+	for _, job := range jobs {
+		m[job.CustNo] = job
+	}
+	return m
+}
+
+func count(t *testing.T, db *gorm.DB, model interface{}) int {
+	t.Helper()
+
+	var n int
+	if err := db.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestBatchReqAdvIdCardOcr(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	server.Script("C0010001.jpg", advancetest.Success(map[string]string{"idNumber": "ABCDE1234F", "name": "RAVI KUMAR"}))
+	server.Script("C0010002.jpg", advancetest.Code(advance.NO_SUPPORTED_CARD))
+	server.Script("C0010003.jpg", advancetest.Code(advance.SERVICE_BUSY), advancetest.Success(nil))
+	server.Script("C0010004.jpg", advancetest.Malformed())
+
+	excelPath := writeExcel(t, "C0010001", "C0010002", "C0010003", "C0010004")
+	before := atomic.LoadInt64(&eventRecords)
+
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 4 || summary.Succeeded != 2 || summary.Failed != 2 || summary.Interrupted {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	jobs := jobStatus(t, db)
+	want := map[string]string{
+		"C0010001": loan.JobSucceeded,
+		"C0010002": loan.JobSkipped,
+		"C0010003": loan.JobSucceeded,
+		"C0010004": loan.JobFailed,
+	}
+	for custNo, status := range want {
+		if got := jobs[custNo].Status; got != status {
+			t.Errorf("expected %s to be %s, got %s", custNo, status, got)
+		}
+	}
+
+	var result loan.CuCustOcrResultDtl
+	if err := db.Where("CUST_NO = ?", "C0010001").First(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	if result.PanNo != "ABCDE1234F" || result.CustName != "RAVI KUMAR" || result.AdvCode != advance.SUCCESS {
+		t.Errorf("unexpected result %#v", result)
+	}
+	if got := count(t, db, &loan.OcrAttempt{}); got != 5 {
+		t.Errorf("expected 5 attempts, got %d", got)
+	}
+	if got, err := svc.CountOcrAttemptsSince(time.Now().Add(-time.Hour)); err != nil || got != 5 {
+		t.Errorf("expected 5 attempts today, got %d %v", got, err)
+	}
+	if got, _ := svc.CountOcrAttemptsSince(time.Now().Add(time.Hour)); got != 0 {
+		t.Errorf("expected no attempts after now, got %d", got)
+	}
+	if got := atomic.LoadInt64(&eventRecords) - before; got != 3 {
+		t.Errorf("expected 3 event records, got %d", got)
+	}
+
+	// 再次运行只重试可重试的失败
+	server.Script("C0010004.jpg", advancetest.Success(nil))
+	summary = svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 1 || summary.Succeeded != 1 {
+		t.Fatalf("unexpected summary on resume %#v", summary)
+	}
+	for _, custNo := range []string{"C0010001", "C0010002", "C0010003"} {
+		if got := server.Count(custNo + ".jpg"); got != map[string]int{"C0010001": 1, "C0010002": 1, "C0010003": 2}[custNo] {
+			t.Errorf("unexpected %d requests for %s", got, custNo)
+		}
+	}
+	if got := jobStatus(t, db)["C0010004"]; got.Status != loan.JobSucceeded || got.Attempts != 2 {
+		t.Errorf("unexpected job %#v", got)
+	}
+}
+
+func TestBatchReqAdvIdCardOcrAbortsOnInsufficientBalance(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	server.Enqueue(advancetest.Code(advance.INSUFFICIENT_BALANCE))
+	excelPath := writeExcel(t, "C0020001", "C0020002", "C0020003", "C0020004", "C0020005")
+
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if !summary.Interrupted {
+		t.Fatalf("expected batch to be interrupted, got %#v", summary)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Fatalf("expected 1 request, got %d", got)
+	}
+	if got := count(t, db, &loan.CuCustOcrResultDtl{}); got != 0 {
+		t.Errorf("expected no results, got %d", got)
+	}
+
+	// 充值后继续
+	svc = initClient(db, server, nil)
+	summary = svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Interrupted || summary.Succeeded != 5 {
+		t.Fatalf("unexpected summary on resume %#v", summary)
+	}
+	if got := count(t, db, &loan.CuCustOcrResultDtl{}); got != 5 {
+		t.Errorf("expected 5 results, got %d", got)
+	}
+}
+
+func TestBatchReqAdvIdCardOcrInterrupted(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	server.SetDefault(advancetest.Success(nil).Slow(100 * time.Millisecond))
+	excelPath := writeExcel(t, "C0030001", "C0030002", "C0030003", "C0030004", "C0030005", "C0030006")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	summary := svc.BatchReqAdvIdCardOcr(ctx, loan.NewExcelSource(excelPath))
+	if !summary.Interrupted || summary.Skipped == 0 {
+		t.Fatalf("expected skipped tasks, got %#v", summary)
+	}
+	for custNo, job := range jobStatus(t, db) {
+		if job.Status == loan.JobInFlight {
+			t.Errorf("expected %s not to be left in flight", custNo)
+		}
+	}
+
+	server.SetDefault(advancetest.Success(nil))
+	summary = svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if got := count(t, db, &loan.CuCustOcrResultDtl{}); got != 6 {
+		t.Errorf("expected 6 results, got %d (%#v)", got, summary)
+	}
+	if got := len(server.Requests()); got != 6 {
+		t.Errorf("expected each image to be sent once, got %d requests", got)
+	}
+}
+
+func TestPlanOcr(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	excelPath := writeExcel(t, "C0040001", "C0040002", "C0040003")
+	if summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath)); summary.Succeeded != 3 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	excelPath = writeExcel(t, "C0040001", "C0040004", "C0040004", "C0040005", "C0040006")
+	if err := os.Remove(filepath.Join(baseDir, t.Name(), "C0040005.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	// 下载中断留下的空文件
+	if err := ioutil.WriteFile(filepath.Join(baseDir, t.Name(), "C0040006.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobs := count(t, db, &loan.OcrJob{})
+
+	plan, err := svc.PlanOcr(loan.NewExcelSource(excelPath), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Total != 5 || plan.Processed != 1 || plan.Pending != 3 || len(plan.Duplicates) != 1 ||
+		len(plan.Missing) != 2 || plan.EstimatedCalls != 1 {
+		t.Errorf("unexpected plan %#v", plan)
+	}
+	if len(plan.ByBusiType) != 1 || plan.ByBusiType[0].Pending != 3 || plan.ByBusiType[0].Missing != 2 {
+		t.Errorf("unexpected busiType plan %#v", plan.ByBusiType)
+	}
+
+	planOut := filepath.Join(t.TempDir(), "plan.json")
+	if err := plan.Export(planOut); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(planOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"estimatedDuration": "1s"`) || !strings.Contains(string(data), `"pending": 3`) {
+		t.Errorf("unexpected exported plan %s", data)
+	}
+	if got := count(t, db, &loan.OcrJob{}); got != jobs {
+		t.Errorf("expected plan not to write jobs, got %d want %d", got, jobs)
+	}
+	if got := len(server.Requests()); got != 3 {
+		t.Errorf("expected plan not to call ADV, got %d requests", got)
+	}
+}
+
+func TestPlanOcrWritesNoReport(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, _ := setup(t, server)
+
+	filename := writeFile(t, "pan.csv", `custNo,busiType,inPath
+C0240001,1,pan/C0240001.jpg
+bad,1,pan/bad.jpg
+`)
+	plan, err := svc.PlanOcr(loan.NewCsvSource(filename), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Total != 1 || len(plan.Rejected) != 1 {
+		t.Errorf("unexpected plan %#v", plan)
+	}
+	// 预览没有副作用
+	if _, err := os.Stat(strings.TrimSuffix(filename, ".csv") + ".rejected.csv"); !os.IsNotExist(err) {
+		t.Errorf("expected no rejected report, got %v", err)
+	}
+}
+
+func TestBatchDownloadAndOcr(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		inMemory := inMemory
+		t.Run(fmt.Sprintf("inMemory=%t", inMemory), func(t *testing.T) {
+			server := advancetest.NewServer()
+			defer server.Close()
+			svc, db := setup(t, server)
+			downloader := newFakeDownloader()
+			svc = initClient(db, server, downloader)
+
+			excelPath := writeExcel(t, "C0050001", "C0050002", "C0050003")
+			// 只有 C0050001 已下载到本地
+			for _, custNo := range []string{"C0050002", "C0050003"} {
+				if err := os.Remove(filepath.Join(baseDir, t.Name(), custNo+".jpg")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			summary := svc.BatchDownloadAndOcr(context.Background(), loan.NewExcelSource(excelPath), inMemory)
+			if summary.Total != 3 || summary.Succeeded != 3 {
+				t.Fatalf("unexpected summary %#v", summary)
+			}
+			if got := count(t, db, &loan.CuCustOcrResultDtl{}); got != 3 {
+				t.Errorf("expected 3 results, got %d", got)
+			}
+
+			for _, custNo := range []string{"C0050001", "C0050002", "C0050003"} {
+				key := filepath.Join(t.Name(), custNo+".jpg")
+				if got := server.Count(custNo + ".jpg"); got != 1 {
+					t.Errorf("expected 1 OCR request for %s, got %d", custNo, got)
+				}
+				want := 1
+				if custNo == "C0050001" {
+					want = 0
+				}
+				if got := downloader.count(key); got != want {
+					t.Errorf("expected %d downloads for %s, got %d", want, custNo, got)
+				}
+				_, err := os.Stat(filepath.Join(baseDir, key))
+				if exist := err == nil; exist != (custNo == "C0050001" || !inMemory) {
+					t.Errorf("unexpected local image for %s, exist %t", custNo, exist)
+				}
+			}
+		})
+	}
+}
+
+// 每读取一行后等待该行开始识别，用于验证边读取边处理
+type waitingSource struct {
+	*loan.ExcelSource
+	server *advancetest.Server
+}
+
+func (ths *waitingSource) Each(fn func(row int, file loan.LoanFile) error) error {
+	return ths.ExcelSource.Each(func(row int, file loan.LoanFile) error {
+		if err := fn(row, file); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for ths.server.Count(filepath.Base(file.InPath)) == 0 {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("row %d not processed before reading the next row", row)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+}
+
+func TestBatchReqAdvIdCardOcrStreaming(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	excelPath := writeExcel(t, "C0080001", "C0080002", "C0080003")
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(),
+		&waitingSource{ExcelSource: loan.NewExcelSource(excelPath), server: server})
+	if summary.Total != 3 || summary.Succeeded != 3 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if got := count(t, db, &loan.CuCustOcrResultDtl{}); got != 3 {
+		t.Errorf("expected 3 results, got %d", got)
+	}
+}
+
+func TestBatchReqAdvIdCardOcrPreprocess(t *testing.T) {
+	cfg := &config.App().Pdl.Preprocess
+	cfg.Enabled = true
+	defer func() { cfg.Enabled = false }()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	excelPath := writeExcel(t, "C0100001", "C0100002")
+	// C0100001 为 PNG，C0100002 不是图片
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(baseDir, t.Name(), "C0100001.jpg"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(baseDir, t.Name(), "C0100002.jpg"), bytes.Repeat([]byte("text "), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 2 || summary.Succeeded != 1 || summary.Failed != 1 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 || requests[0].Filename != "C0100001.jpg" || requests[0].Size >= int64(buf.Len()) {
+		t.Errorf("expected re-encoded C0100001 only, got %#v", requests)
+	}
+	job := jobStatus(t, db)["C0100002"]
+	if job.Status != loan.JobSkipped || job.LastCode != imgprep.RejectedCode || job.Attempts != 0 {
+		t.Errorf("unexpected rejected job %#v", job)
+	}
+}
+
+func TestOcrResultVerification(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	// 只用于生成图片
+	writeExcel(t, "C0130001", "C0130002", "C0130003")
+	server.Script("C0130001.jpg", advancetest.Success(map[string]string{
+		"idNumber": "abcpk 1234f", "name": " Ravi  kumar.", "birthday": "15/08/1990", "fatherName": "ram kumar"}))
+	server.Script("C0130002.jpg", advancetest.Success(map[string]string{
+		"idNumber": "ABCPK12S4F", "name": "SUNIL SHARMA", "birthday": "1990-13-45"}))
+	server.Script("C0130003.jpg", advancetest.Success(map[string]string{
+		"idNumber": "ABCDE1234F", "name": "RAVI KUMAR", "birthday": "15/08/1990"}))
+
+	var lines []string
+	for _, custNo := range []string{"C0130001", "C0130002", "C0130003"} {
+		lines = append(lines, fmt.Sprintf(`{"custNo":%q,"busiType":"1","inPath":%q,"holderName":"Kumar Ravi"}`,
+			custNo, filepath.ToSlash(filepath.Join(t.Name(), custNo+".jpg"))))
+	}
+	src := writeFile(t, "pan.jsonl", strings.Join(lines, "\n"))
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewJsonlSource(src))
+	if summary.Total != 3 || summary.Succeeded != 3 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	var results []loan.CuCustOcrResultDtl
+	if err := db.Order("CUST_NO").Find(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	valid := results[0]
+	if valid.VerifyStatus != verify.StatusValid || valid.PanNo != "ABCPK1234F" || valid.CustName != "RAVI KUMAR" ||
+		valid.FatherName != "RAM KUMAR" || valid.BirthDate == nil || valid.BirthDate.Format("2006-01-02") != "1990-08-15" {
+		t.Errorf("unexpected valid result %#v", valid)
+	}
+	// PAN 需纠正且出生日期无法解析，姓名不符，PAN 保留识别出的值
+	if got := results[1]; got.VerifyStatus != verify.StatusNameMismatch || got.PanNo != "ABCPK12S4F" || got.BirthDate != nil ||
+		!strings.Contains(got.VerifyMessage, "unparseable birthday") ||
+		!strings.Contains(got.ExtraInfo, `"`+loan.SuggestedPanKey+`":"ABCPK1254F"`) {
+		t.Errorf("unexpected mismatch result %#v", got)
+	}
+	if got := results[2]; got.VerifyStatus != verify.StatusInvalid || got.PanNo != "ABCDE1234F" {
+		t.Errorf("unexpected invalid result %#v", got)
+	}
+}
+
+func TestBatchReqAdvIdCardOcrCardType(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	// busiType 直接填写证件类型
+	writeExcel(t, "C0200001")
+	server.Script("C0200001.jpg", advancetest.Success(map[string]string{
+		"idNumber": "MH1420110062821", "name": "RAVI KUMAR", "birthday": "15/08/1990", "address": "PUNE", "expiryDate": "14/08/2030"}))
+	line := fmt.Sprintf(`{"custNo":"C0200001","busiType":%q,"inPath":%q}`,
+		ocr.DrivingLicenceFront, filepath.ToSlash(filepath.Join(t.Name(), "C0200001.jpg")))
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewJsonlSource(writeFile(t, "card.jsonl", line)))
+	if summary.Total != 1 || summary.Succeeded != 1 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if requests := server.Requests(); len(requests) != 1 || requests[0].CardType != ocr.DrivingLicenceFront {
+		t.Errorf("unexpected requests %#v", requests)
+	}
+
+	result, err := svc.LatestOcrResult("C0200001", ocr.DrivingLicenceFront)
+	if err != nil || result == nil {
+		t.Fatalf("expected result, got %#v %v", result, err)
+	}
+	if result.CardType != ocr.DrivingLicenceFront || result.PanNo != "MH1420110062821" || result.Address != "PUNE" ||
+		!strings.Contains(result.ExtraInfo, "2030") {
+		t.Errorf("unexpected result %#v", result)
+	}
+	if job := jobStatus(t, db)["C0200001"]; job.BusiType != ocr.DrivingLicenceFront || job.Status != loan.JobSucceeded {
+		t.Errorf("unexpected job %#v", job)
+	}
+
+	// sqlite 不校验长度，检查各表 BUSI_TYPE 的定义能容纳证件类型
+	size := regexp.MustCompile(`varchar\((\d+)\)`)
+	for _, model := range []interface{}{&loan.CuCustOcrResultDtl{}, &loan.OcrResultHistory{}, &loan.OcrJob{},
+		&loan.OcrAttempt{}, &loan.OcrImageCache{}, &loan.EventOutbox{}} {
+		field, _ := db.NewScope(model).FieldByName("BusiType")
+		tp, _ := field.TagSettingsGet("TYPE")
+		m := size.FindStringSubmatch(tp)
+		if n, _ := strconv.Atoi(m[1]); n < len(ocr.DrivingLicenceFront) {
+			t.Errorf("BUSI_TYPE of %T too short: %s", model, tp)
+		}
+	}
+}
+
+func TestBatchReqAdvIdCardOcrShortCustNo(t *testing.T) {
+	input := &config.App().Pdl.Input
+	saved := *input
+	input.CustNoPattern = `^[A-Z0-9]{1,40}$`
+	defer func() { *input = saved }()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	before := atomic.LoadInt64(&eventRecords)
+	excelPath := writeExcel(t, "C21")
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 1 || summary.Succeeded != 1 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if got := jobStatus(t, db)["C21"]; got.Status != loan.JobSucceeded {
+		t.Errorf("unexpected job %#v", got)
+	}
+	if got := atomic.LoadInt64(&eventRecords) - before; got != 1 {
+		t.Errorf("expected 1 event record, got %d", got)
+	}
+}
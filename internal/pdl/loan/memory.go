@@ -0,0 +1,335 @@
+package loan
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 内存中的识别结果存储，用于测试，不加密
+type memoryOcrResultRepo struct {
+	mu        sync.Mutex
+	results   map[string]CuCustOcrResultDtl
+	histories map[string][]OcrResultHistory
+}
+
+func NewMemoryOcrResultRepo() OcrResultRepo {
+	return &memoryOcrResultRepo{
+		results:   make(map[string]CuCustOcrResultDtl),
+		histories: make(map[string][]OcrResultHistory),
+	}
+}
+
+func (ths *memoryOcrResultRepo) Save(result *CuCustOcrResultDtl) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	now := time.Now()
+	key := jobKey(result.CustNo, result.BusiType)
+	if existing, ok := ths.results[key]; ok {
+		ths.histories[key] = append(ths.histories[key], newOcrResultHistory(&existing, now))
+		result.Id = existing.Id
+		result.InstTime = existing.InstTime
+	} else {
+		result.Id = result.GenerateUUID()
+		result.InstTime = now
+	}
+	result.UpdtTime = now
+	ths.results[key] = *result
+	return nil
+}
+
+func (ths *memoryOcrResultRepo) Latest(custNo string, busiType string) (*CuCustOcrResultDtl, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	result, ok := ths.results[jobKey(custNo, busiType)]
+	if !ok {
+		return nil, nil
+	}
+	return &result, nil
+}
+
+func (ths *memoryOcrResultRepo) LatestAll() (map[string]*CuCustOcrResultDtl, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	resultMap := make(map[string]*CuCustOcrResultDtl, len(ths.results))
+	for key, result := range ths.results {
+		result := result
+		resultMap[key] = &result
+	}
+	return resultMap, nil
+}
+
+func (ths *memoryOcrResultRepo) History(custNo string, busiType string) ([]*OcrResultHistory, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	archived := ths.histories[jobKey(custNo, busiType)]
+	histories := make([]*OcrResultHistory, 0, len(archived))
+	for i := len(archived) - 1; i >= 0; i-- {
+		history := archived[i]
+		histories = append(histories, &history)
+	}
+	return histories, nil
+}
+
+// 内存中的三方调用记录存储，用于测试
+type memoryThirdServiceRecordRepo struct {
+	mu      sync.Mutex
+	records []PointThirdServiceRecord
+}
+
+func NewMemoryThirdServiceRecordRepo() ThirdServiceRecordRepo {
+	return &memoryThirdServiceRecordRepo{}
+}
+
+func (ths *memoryThirdServiceRecordRepo) Add(record *PointThirdServiceRecord) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.records = append(ths.records, *record)
+	return nil
+}
+
+func (ths *memoryThirdServiceRecordRepo) FindByTransactionId(transactionId string) ([]PointThirdServiceRecord, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	var records []PointThirdServiceRecord
+	for _, record := range ths.records {
+		if record.TransactionId == transactionId {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// 内存中的埋点发件箱，用于测试
+type memoryEventOutboxRepo struct {
+	mu     sync.Mutex
+	events map[string]EventOutbox
+}
+
+func NewMemoryEventOutboxRepo() EventOutboxRepo {
+	return &memoryEventOutboxRepo{events: make(map[string]EventOutbox)}
+}
+
+func (ths *memoryEventOutboxRepo) Add(event *EventOutbox) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.events[event.Id] = *event
+	return nil
+}
+
+func (ths *memoryEventOutboxRepo) Due(now time.Time, limit int) ([]EventOutbox, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	var events []EventOutbox
+	for _, event := range ths.events {
+		if event.Status == EventPending && !event.NextTime.After(now) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].InstTime.Before(events[j].InstTime)
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (ths *memoryEventOutboxRepo) Update(event *EventOutbox) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.events[event.Id] = *event
+	return nil
+}
+
+func (ths *memoryEventOutboxRepo) Reset(now time.Time) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	for id, event := range ths.events {
+		if event.Status == EventPending || event.Status == EventFailed {
+			event.Status = EventPending
+			event.Attempts = 0
+			event.NextTime = now
+			event.UpdtTime = now
+			ths.events[id] = event
+		}
+	}
+	return nil
+}
+
+func (ths *memoryEventOutboxRepo) Undelivered() (int, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	count := 0
+	for _, event := range ths.events {
+		if event.Status == EventPending || event.Status == EventFailed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// 内存中的任务台账，用于测试
+type memoryOcrJobRepo struct {
+	mu   sync.Mutex
+	jobs map[string]OcrJob
+}
+
+func NewMemoryOcrJobRepo() OcrJobRepo {
+	return &memoryOcrJobRepo{jobs: make(map[string]OcrJob)}
+}
+
+func (ths *memoryOcrJobRepo) Create(job *OcrJob) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	key := jobKey(job.CustNo, job.BusiType)
+	if _, ok := ths.jobs[key]; ok {
+		return fmt.Errorf("ocr job %s already exists", key)
+	}
+	ths.jobs[key] = *job
+	return nil
+}
+
+func (ths *memoryOcrJobRepo) Update(job *OcrJob) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.jobs[jobKey(job.CustNo, job.BusiType)] = *job
+	return nil
+}
+
+func (ths *memoryOcrJobRepo) All() (map[string]*OcrJob, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	jobMap := make(map[string]*OcrJob, len(ths.jobs))
+	for key, job := range ths.jobs {
+		job := job
+		jobMap[key] = &job
+	}
+	return jobMap, nil
+}
+
+func (ths *memoryOcrJobRepo) ResetInFlight(now time.Time) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	for key, job := range ths.jobs {
+		if job.Status == JobInFlight {
+			job.Status = JobPending
+			job.UpdtTime = now
+			ths.jobs[key] = job
+		}
+	}
+	return nil
+}
+
+// 内存中的调用明细，用于测试
+type memoryOcrAttemptRepo struct {
+	mu       sync.Mutex
+	attempts []OcrAttempt
+}
+
+func NewMemoryOcrAttemptRepo() OcrAttemptRepo {
+	return &memoryOcrAttemptRepo{}
+}
+
+func (ths *memoryOcrAttemptRepo) Add(attempt *OcrAttempt) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.attempts = append(ths.attempts, *attempt)
+	return nil
+}
+
+func (ths *memoryOcrAttemptRepo) CountSince(since time.Time) (int, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	count := 0
+	for _, attempt := range ths.attempts {
+		if !attempt.RequestTime.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ths *memoryOcrAttemptRepo) PaidCalls() (map[string]int, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	paidCalls := make(map[string]int)
+	for _, attempt := range ths.attempts {
+		if attempt.IsPay == "10000001" {
+			paidCalls[jobKey(attempt.CustNo, attempt.BusiType)]++
+		}
+	}
+	return paidCalls, nil
+}
+
+// 内存中的识别结果缓存，用于测试，不加密
+type memoryImageCacheRepo struct {
+	mu     sync.Mutex
+	caches map[string]OcrImageCache
+}
+
+func NewMemoryImageCacheRepo() ImageCacheRepo {
+	return &memoryImageCacheRepo{caches: make(map[string]OcrImageCache)}
+}
+
+func (ths *memoryImageCacheRepo) Find(id string) (*OcrImageCache, error) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	cache, ok := ths.caches[id]
+	if !ok {
+		return nil, nil
+	}
+	return &cache, nil
+}
+
+func (ths *memoryImageCacheRepo) Save(cache *OcrImageCache) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	ths.caches[cache.Id] = *cache
+	return nil
+}
+
+func (ths *memoryImageCacheRepo) Hit(id string, now time.Time) error {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	if cache, ok := ths.caches[id]; ok {
+		cache.Hits++
+		cache.UpdtTime = now
+		ths.caches[id] = cache
+	}
+	return nil
+}
+
+// 全部使用内存存储，用于测试
+func NewMemoryRepos() Repos {
+	return Repos{
+		Results:  NewMemoryOcrResultRepo(),
+		Records:  NewMemoryThirdServiceRecordRepo(),
+		Events:   NewMemoryEventOutboxRepo(),
+		Jobs:     NewMemoryOcrJobRepo(),
+		Attempts: NewMemoryOcrAttemptRepo(),
+		Images:   NewMemoryImageCacheRepo(),
+	}
+}
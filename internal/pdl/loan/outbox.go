@@ -0,0 +1,292 @@
+package loan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 埋点发送状态
+const (
+	EventPending   = "PENDING"   // 待发送，含失败后等待重试的
+	EventDelivered = "DELIVERED" // 已送达
+	EventFailed    = "FAILED"    // 超过最大重试次数，需 pdl events replay 重发
+)
+
+// 埋点发件箱，先落库再异步发送到 EventServer，进程退出后未送达的记录下次继续发送
+type EventOutbox struct {
+	Id            string    `json:"id" gorm:"primary_key;type:varchar(40);comment:'ID'"`
+	InstTime      time.Time `json:"instTime" gorm:"column:INST_TIME;type:datetime;comment:'插入时间'"`
+	UpdtTime      time.Time `json:"updtTime" gorm:"column:UPDT_TIME;type:datetime;comment:'修改时间'"`
+	CustNo        string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);comment:'客户唯一编码'"`
+	BusiType      string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(40);comment:'业务类型（码类：1007）'"`
+	TransactionId string    `json:"transactionId" gorm:"column:TRANSACTION_ID;type:varchar(80);comment:'三方响应的transactionId'"`
+	Payload       string    `json:"payload" gorm:"column:PAYLOAD;type:text;comment:'埋点内容（JSON）'"`
+	Status        string    `json:"status" gorm:"column:STATUS;type:varchar(16);index:idx_outbox_status;comment:'发送状态'"`
+	Attempts      int       `json:"attempts" gorm:"column:ATTEMPTS;type:int;comment:'发送次数'"`
+	NextTime      time.Time `json:"nextTime" gorm:"column:NEXT_TIME;type:datetime;comment:'下次发送时间'"`
+	LastError     string    `json:"lastError" gorm:"column:LAST_ERROR;type:varchar(400);comment:'最后一次错误'"`
+}
+
+func (EventOutbox) TableName() string {
+	return "pdl_event_outbox"
+}
+
+// 发件箱发送器，按批发送到期的待发送记录，失败后按指数退避重试
+type EventSender struct {
+	url            string
+	batchUrl       string
+	batchSize      int
+	interval       time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	events         EventOutboxRepo
+	client         *http.Client
+
+	mu     sync.Mutex
+	queued int64
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// 使用 Pdl.EventServer 配置，未配置的项使用默认值
+func (ths *Service) NewEventSender() *EventSender {
+	cfg := config.App().Pdl.EventServer
+	sender := &EventSender{
+		url:            cfg.ThirdUrl,
+		batchUrl:       cfg.BatchUrl,
+		batchSize:      cfg.BatchSize,
+		interval:       time.Duration(cfg.FlushInterval) * time.Second,
+		maxAttempts:    cfg.Retry.MaxAttempts,
+		initialBackoff: time.Duration(cfg.Retry.InitialBackoff) * time.Millisecond,
+		maxBackoff:     time.Duration(cfg.Retry.MaxBackoff) * time.Millisecond,
+		multiplier:     cfg.Retry.Multiplier,
+		events:         ths.repos.Events,
+		client:         ths.httpClient,
+		notify:         make(chan struct{}, 1),
+	}
+	if sender.batchSize <= 0 {
+		sender.batchSize = 50
+	}
+	if sender.interval <= 0 {
+		sender.interval = 5 * time.Second
+	}
+	if sender.maxAttempts <= 0 {
+		sender.maxAttempts = 10
+	}
+	if sender.initialBackoff <= 0 {
+		sender.initialBackoff = time.Second
+	}
+	if sender.maxBackoff <= 0 {
+		sender.maxBackoff = 5 * time.Minute
+	}
+	if sender.multiplier < 1 {
+		sender.multiplier = 2
+	}
+	return sender
+}
+
+// 后台定时发送，攒够一批时提前发送
+func (ths *EventSender) Start(ctx context.Context) {
+	ths.stop = make(chan struct{})
+	ths.done = make(chan struct{})
+	go func() {
+		defer close(ths.done)
+		ticker := time.NewTicker(ths.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ths.stop:
+				return
+			case <-ticker.C:
+			case <-ths.notify:
+			}
+			ths.Flush(ctx)
+		}
+	}()
+}
+
+// 新埋点已落库
+func (ths *EventSender) Notify() {
+	if atomic.AddInt64(&ths.queued, 1)%int64(ths.batchSize) != 0 {
+		return
+	}
+	select {
+	case ths.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 等待进行中的发送结束后停止后台发送，并在 timeout 内发送剩余记录，未送达的留待下次
+func (ths *EventSender) Close(timeout time.Duration) {
+	if ths.stop != nil {
+		close(ths.stop)
+		<-ths.done
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ths.Flush(ctx)
+}
+
+// 发送所有到期的待发送记录，返回送达和失败条数
+func (ths *EventSender) Flush(ctx context.Context) (int, int) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	delivered, failed := 0, 0
+	// 本次已发送过的记录，状态未保存时不再重复发送
+	sent := make(map[string]bool)
+	for ctx.Err() == nil {
+		due, err := ths.events.Due(time.Now(), ths.batchSize)
+		if err != nil {
+			log.Errorf("Load event outbox err: %s", err)
+			break
+		}
+		var events []EventOutbox
+		for _, event := range due {
+			if !sent[event.Id] {
+				sent[event.Id] = true
+				events = append(events, event)
+			}
+		}
+		if len(events) == 0 {
+			break
+		}
+		n, m, err := ths.send(ctx, events)
+		delivered += n
+		failed += m
+		if err != nil {
+			log.Errorf("Save event outbox err: %s", err)
+			break
+		}
+		if n+m == 0 {
+			break
+		}
+	}
+	if delivered > 0 || failed > 0 {
+		log.Infof("埋点发送 送达 %d 失败 %d", delivered, failed)
+	}
+	return delivered, failed
+}
+
+// 已超过最大重试次数的记录重新置为待发送，连同其余未送达记录立即发送
+func (ths *EventSender) Replay(ctx context.Context) (int, int, error) {
+	if err := ths.events.Reset(time.Now()); err != nil {
+		return 0, 0, err
+	}
+	delivered, failed := ths.Flush(ctx)
+	return delivered, failed, nil
+}
+
+// 发送一批，配置了批量接口时一次发送，否则逐条发送，发送结果未能保存时返回错误
+func (ths *EventSender) send(ctx context.Context, events []EventOutbox) (int, int, error) {
+	if ths.batchUrl != "" {
+		payloads := make([]json.RawMessage, len(events))
+		for i, event := range events {
+			payloads[i] = json.RawMessage(event.Payload)
+		}
+		body, err := json.Marshal(payloads)
+		if err == nil {
+			err = WriteReqOcrRecord(ctx, ths.client, ths.batchUrl, body)
+		}
+		// 取消导致的失败不计入发送次数，留待下次
+		if err != nil && ctx.Err() != nil {
+			return 0, 0, nil
+		}
+		var saveErr error
+		for i := range events {
+			if e := ths.mark(&events[i], err); e != nil && saveErr == nil {
+				saveErr = e
+			}
+		}
+		if err != nil {
+			return 0, len(events), saveErr
+		}
+		return len(events), 0, saveErr
+	}
+
+	delivered, failed := 0, 0
+	for i := range events {
+		err := WriteReqOcrRecord(ctx, ths.client, ths.url, []byte(events[i].Payload))
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			failed++
+		} else {
+			delivered++
+		}
+		if e := ths.mark(&events[i], err); e != nil {
+			return delivered, failed, e
+		}
+	}
+	return delivered, failed, nil
+}
+
+// 记录发送结果，失败时计算下次发送时间
+func (ths *EventSender) mark(event *EventOutbox, err error) error {
+	event.Attempts++
+	event.UpdtTime = time.Now()
+	if err == nil {
+		event.Status = EventDelivered
+		event.LastError = ""
+	} else {
+		event.LastError = truncate(err.Error(), 400)
+		event.NextTime = event.UpdtTime.Add(ths.backoff(event.Attempts))
+		if event.Attempts >= ths.maxAttempts {
+			event.Status = EventFailed
+			log.Errorf("Event %s of %s failed after %d attempts: %s", event.Id, event.CustNo, event.Attempts, err)
+		}
+	}
+	if err := ths.events.Update(event); err != nil {
+		return fmt.Errorf("save event outbox %s: %w", event.Id, err)
+	}
+	return nil
+}
+
+// 第 n 次失败后的等待时间
+func (ths *EventSender) backoff(n int) time.Duration {
+	backoff := float64(ths.initialBackoff)
+	for i := 1; i < n && backoff < float64(ths.maxBackoff); i++ {
+		backoff *= ths.multiplier
+	}
+	if backoff > float64(ths.maxBackoff) {
+		return ths.maxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// 调用埋点，非 200 响应视为失败
+func WriteReqOcrRecord(ctx context.Context, client *http.Client, pointUrl string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", pointUrl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event server returned %d: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+	return nil
+}
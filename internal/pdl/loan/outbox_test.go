@@ -0,0 +1,188 @@
+package loan_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+)
+
+// 可切换成功失败的埋点服务，记录收到的每个请求的埋点条数
+type eventServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	down    bool
+	batches []int
+}
+
+func newEventServer() *eventServer {
+	ths := &eventServer{}
+	ths.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ths.mu.Lock()
+		defer ths.mu.Unlock()
+		if ths.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var records []loan.PointThirdServiceRecord
+		if json.Unmarshal(body, &records) == nil {
+			ths.batches = append(ths.batches, len(records))
+		} else {
+			ths.batches = append(ths.batches, 1)
+		}
+	}))
+	return ths
+}
+
+func (ths *eventServer) setDown(down bool) {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	ths.down = down
+}
+
+func (ths *eventServer) received() []int {
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+	return append([]int(nil), ths.batches...)
+}
+
+func eventStatus(t *testing.T, db *gorm.DB) map[string]int {
+	t.Helper()
+	var events []loan.EventOutbox
+	if err := db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[string]int)
+	for _, event := range events {
+		status[event.Status]++
+	}
+	return status
+}
+
+func TestEventOutboxReplay(t *testing.T) {
+	events := newEventServer()
+	defer events.Close()
+	cfg := &config.App().Pdl.EventServer
+	saved := *cfg
+	cfg.ThirdUrl = events.URL
+	cfg.Retry.MaxAttempts = 1
+	defer func() { *cfg = saved }()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	// 埋点服务不可用时 OCR 照常完成，埋点留在发件箱
+	events.setDown(true)
+	excelPath := writeExcel(t, "C0110001", "C0110002", "C0110003")
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 3 || summary.Succeeded != 3 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if status := eventStatus(t, db); status[loan.EventFailed] != 3 {
+		t.Fatalf("expected 3 failed events, got %v", status)
+	}
+	if got, _ := svc.UndeliveredEvents(); got != 3 {
+		t.Errorf("expected 3 undelivered events, got %d", got)
+	}
+
+	events.setDown(false)
+	delivered, failed, err := svc.NewEventSender().Replay(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 3 || failed != 0 {
+		t.Errorf("expected 3 delivered, got %d delivered %d failed", delivered, failed)
+	}
+	if status := eventStatus(t, db); status[loan.EventDelivered] != 3 {
+		t.Errorf("expected 3 delivered events, got %v", status)
+	}
+	if got := len(events.received()); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestEventOutboxBatch(t *testing.T) {
+	events := newEventServer()
+	defer events.Close()
+	cfg := &config.App().Pdl.EventServer
+	saved := *cfg
+	cfg.BatchUrl = events.URL
+	cfg.BatchSize = 2
+	defer func() { *cfg = saved }()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	excelPath := writeExcel(t, "C0120001", "C0120002", "C0120003")
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 3 || summary.Succeeded != 3 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+	if status := eventStatus(t, db); status[loan.EventDelivered] != 3 {
+		t.Errorf("expected 3 delivered events, got %v", status)
+	}
+	total := 0
+	for _, n := range events.received() {
+		if n > 2 {
+			t.Errorf("expected at most 2 records per batch, got %d", n)
+		}
+		total += n
+	}
+	if total != 3 {
+		t.Errorf("expected 3 records in batches, got %v", events.received())
+	}
+}
+
+// 发送结果无法保存的发件箱
+type brokenOutboxRepo struct {
+	loan.EventOutboxRepo
+}
+
+func (ths brokenOutboxRepo) Update(event *loan.EventOutbox) error {
+	return errors.New("database is down")
+}
+
+func TestEventOutboxUpdateFails(t *testing.T) {
+	events := newEventServer()
+	defer events.Close()
+	cfg := &config.App().Pdl.EventServer
+	saved := *cfg
+	cfg.ThirdUrl = events.URL
+	defer func() { *cfg = saved }()
+
+	repos := loan.NewMemoryRepos()
+	repos.Events = brokenOutboxRepo{repos.Events}
+	now := time.Now()
+	for _, id := range []string{"e1", "e2"} {
+		if err := repos.Events.Add(&loan.EventOutbox{Id: id, InstTime: now, Payload: "{}", Status: loan.EventPending, NextTime: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 状态未保存时停止发送，不反复重发同一批
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	delivered, failed := loan.NewService(repos, nil, nil).NewEventSender().Flush(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("flush did not stop")
+	}
+	if delivered != 1 || failed != 0 {
+		t.Errorf("expected 1 delivered, got %d %d", delivered, failed)
+	}
+	if got := len(events.received()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
@@ -0,0 +1,168 @@
+package loan
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/verify"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/onlythinking/pug-go/pkg/pugcrypto"
+)
+
+// 加密密钥环境变量，优先于 Security.EncryptionKey
+const EncryptionKeyEnv = "PDL_ENCRYPTION_KEY"
+
+var (
+	cipherOnce  sync.Once
+	fieldCipher *pugcrypto.Cipher
+	cipherErr   error
+)
+
+// 按环境变量或配置创建个人信息字段加密，未配置密钥时返回 nil，字段明文保存
+func NewFieldCipher() (*pugcrypto.Cipher, error) {
+	encoded := os.Getenv(EncryptionKeyEnv)
+	if encoded == "" {
+		encoded = config.App().Security.EncryptionKey
+	}
+	if encoded == "" {
+		log.Warn("未配置加密密钥，个人信息字段明文保存")
+		return nil, nil
+	}
+	key, err := pugcrypto.ParseKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+	c, err := pugcrypto.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+	return c, nil
+}
+
+// 启动时加载并校验密钥，密钥无效时返回错误，避免在落库时才失败
+func InitFieldCipher() error {
+	_, err := piiCipher()
+	return err
+}
+
+// 个人信息字段加密，未配置密钥时返回 nil，密钥无效时返回错误
+func piiCipher() (*pugcrypto.Cipher, error) {
+	cipherOnce.Do(func() {
+		fieldCipher, cipherErr = NewFieldCipher()
+	})
+	return fieldCipher, cipherErr
+}
+
+// 替换个人信息字段加密，nil 表示不加密
+func SetFieldCipher(c *pugcrypto.Cipher) {
+	cipherOnce.Do(func() {})
+	fieldCipher, cipherErr = c, nil
+}
+
+func encryptFields(c *pugcrypto.Cipher, fields ...*string) error {
+	for _, field := range fields {
+		value, err := c.Encrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+// 未加密的值原样保留，加密启用前的数据仍可读取
+func decryptFields(c *pugcrypto.Cipher, fields ...*string) error {
+	for _, field := range fields {
+		value, err := c.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+func (ths *CuCustOcrResultDtl) piiFields() []*string {
+	return []*string{&ths.PanNo, &ths.CustName, &ths.Birthday, &ths.FatherName, &ths.Address, &ths.ExtraInfo, &ths.BirthDateText}
+}
+
+// 落库前加密个人信息字段，出生日期每次由 BirthDate 重新生成，重复调用结果不变
+func (ths *CuCustOcrResultDtl) BeforeSave() error {
+	ths.BirthDateText = formatBirthDate(ths.BirthDate)
+	c, err := piiCipher()
+	if c == nil {
+		return err
+	}
+	return encryptFields(c, ths.piiFields()...)
+}
+
+// 落库后还原明文，调用方可继续使用
+func (ths *CuCustOcrResultDtl) AfterSave() error {
+	c, err := piiCipher()
+	if c == nil {
+		return err
+	}
+	return decryptFields(c, ths.piiFields()...)
+}
+
+// 查询后解密并还原出生日期
+func (ths *CuCustOcrResultDtl) AfterFind() error {
+	c, err := piiCipher()
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		if err := decryptFields(c, ths.piiFields()...); err != nil {
+			return err
+		}
+	}
+	ths.BirthDate = parseBirthDate(ths.BirthDateText, ths.Birthday)
+	return nil
+}
+
+const birthDateLayout = "2006-01-02"
+
+func formatBirthDate(birthDate *time.Time) string {
+	if birthDate == nil {
+		return ""
+	}
+	return birthDate.Format(birthDateLayout)
+}
+
+// 未保存出生日期的旧数据由 Birthday 解析
+func parseBirthDate(text string, birthday string) *time.Time {
+	if text != "" {
+		if birthDate, err := time.ParseInLocation(birthDateLayout, text, time.Local); err == nil {
+			return &birthDate
+		}
+	}
+	if birthday != "" {
+		if birthDate, err := verify.ParseBirthday(birthday); err == nil {
+			return &birthDate
+		}
+	}
+	return nil
+}
+
+func (ths *OcrImageCache) BeforeSave() error {
+	c, err := piiCipher()
+	if c == nil {
+		return err
+	}
+	return encryptFields(c, &ths.Fields)
+}
+
+func (ths *OcrImageCache) AfterSave() error {
+	return ths.AfterFind()
+}
+
+func (ths *OcrImageCache) AfterFind() error {
+	c, err := piiCipher()
+	if c == nil {
+		return err
+	}
+	return decryptFields(c, &ths.Fields)
+}
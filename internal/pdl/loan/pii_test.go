@@ -0,0 +1,151 @@
+package loan_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/onlythinking/pug-go/pkg/pugcrypto"
+)
+
+func TestOcrResultEncrypted(t *testing.T) {
+	c, err := pugcrypto.NewCipher(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loan.SetFieldCipher(c)
+	defer loan.SetFieldCipher(nil)
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	excelPath := writeExcel(t, "C0140001", "C0140002")
+	server.Script("C0140001.jpg", advancetest.Success(map[string]string{
+		"idNumber": "ABCPK1234F", "name": "RAVI KUMAR", "birthday": "15/08/1990", "fatherName": "RAM KUMAR"}))
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 2 || summary.Succeeded != 2 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	// 库中为密文
+	rows, err := db.Raw("SELECT PAN_NO, CUST_NAME, BIRTHDAY, FATHER_NAME, BIRTH_DATE FROM cu_cust_ocr_result_dtl WHERE CUST_NO = ?", "C0140001").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for rows.Next() {
+		found++
+		var pan, name, birthday, fatherName, birthDate string
+		if err := rows.Scan(&pan, &name, &birthday, &fatherName, &birthDate); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{pan, name, birthday, fatherName, birthDate} {
+			if !pugcrypto.IsEncrypted(v) {
+				t.Errorf("expected encrypted, got %s", v)
+			}
+		}
+	}
+	rows.Close()
+	if found != 1 {
+		t.Fatalf("expected 1 row, got %d", found)
+	}
+
+	var fields string
+	if err := db.Raw("SELECT FIELDS FROM pdl_ocr_image_cache WHERE CUST_NO = ?", "C0140001").Row().Scan(&fields); err != nil {
+		t.Fatal(err)
+	}
+	if !pugcrypto.IsEncrypted(fields) {
+		t.Errorf("expected encrypted cache fields, got %s", fields)
+	}
+
+	// 查询时解密
+	var result loan.CuCustOcrResultDtl
+	if err := db.Where("CUST_NO = ?", "C0140001").First(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	if result.PanNo != "ABCPK1234F" || result.CustName != "RAVI KUMAR" || result.FatherName != "RAM KUMAR" ||
+		result.BirthDate == nil || result.BirthDate.Format("2006-01-02") != "1990-08-15" {
+		t.Errorf("unexpected decrypted result %#v", result)
+	}
+
+	// 上报的埋点遮盖证件号和姓名
+	var events []loan.EventOutbox
+	if err := db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if strings.Contains(event.Payload, "ABCPK1234F") || strings.Contains(event.Payload, "RAVI KUMAR") ||
+			!strings.Contains(event.Payload, "AB******4F") {
+			t.Errorf("expected masked payload, got %s", event.Payload)
+		}
+	}
+}
+
+func TestOcrResultHistoryEncrypted(t *testing.T) {
+	c, err := pugcrypto.NewCipher(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loan.SetFieldCipher(c)
+	defer loan.SetFieldCipher(nil)
+
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	birthDate := time.Date(1990, 8, 15, 0, 0, 0, 0, time.Local)
+	first := loan.CuCustOcrResultDtl{CustNo: "C0170001", BusiType: "1", AdvCode: "SUCCESS", PanNo: "ABCPK1234F", BirthDate: &birthDate}
+	// 重试时同一条记录会再次落库
+	for i := 0; i < 2; i++ {
+		if err := svc.UpsertOcrResult(&first); err != nil {
+			t.Fatal(err)
+		}
+		if first.BirthDate == nil || !first.BirthDate.Equal(birthDate) {
+			t.Fatalf("expected birth date kept after save, got %v", first.BirthDate)
+		}
+	}
+	second := loan.CuCustOcrResultDtl{CustNo: "C0170001", BusiType: "1", AdvCode: "SUCCESS", PanNo: "ABCPK1235F"}
+	if err := svc.UpsertOcrResult(&second); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw []string
+	if err := db.Table("cu_cust_ocr_result_his").Where("CUST_NO = ?", "C0170001").Pluck("BIRTH_DATE", &raw).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range raw {
+		if !pugcrypto.IsEncrypted(v) {
+			t.Errorf("expected encrypted history birth date, got %s", v)
+		}
+	}
+
+	histories, err := svc.OcrResultHistoryOf("C0170001", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 2 {
+		t.Fatalf("expected 2 histories, got %d", len(histories))
+	}
+	for _, history := range histories {
+		if history.BirthDate == nil || !history.BirthDate.Equal(birthDate) || history.PanNo != "ABCPK1234F" {
+			t.Errorf("unexpected history %#v", history)
+		}
+	}
+}
+
+func TestNewFieldCipher(t *testing.T) {
+	t.Setenv(loan.EncryptionKeyEnv, "not a key")
+	if c, err := loan.NewFieldCipher(); err == nil || c != nil {
+		t.Errorf("expected invalid key error, got %v %v", c, err)
+	}
+
+	t.Setenv(loan.EncryptionKeyEnv, strings.Repeat("ab", 32))
+	if c, err := loan.NewFieldCipher(); err != nil || c == nil {
+		t.Errorf("expected cipher, got %v %v", c, err)
+	}
+}
@@ -0,0 +1,203 @@
+package loan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 收到中断信号后未开始处理的任务
+var ErrInterrupted = errors.New("pipeline interrupted")
+
+// 流水线中流转的单条任务
+type Task struct {
+	Index  int
+	Row    int // 源数据中的行号
+	File   LoanFile
+	Job    *OcrJob
+	Image  []byte // 不落盘时下载的图片
+	Hash   string // 图片内容摘要，用于复用相同图片的识别结果
+	Cached bool   // 识别结果复用自相同图片，未调用 OCR
+	Result *ocr.Result
+	Err    error
+}
+
+// 阶段处理函数，返回错误后任务跳过后续普通阶段
+type StageFunc func(ctx context.Context, task *Task) error
+
+type stage struct {
+	name    string
+	workers int
+	always  bool
+	fn      StageFunc
+}
+
+// 批处理结果汇总
+type Summary struct {
+	Total       int64
+	Succeeded   int64
+	Failed      int64
+	Skipped     int64
+	Interrupted bool
+	Elapsed     time.Duration
+}
+
+// 多阶段工作池流水线：reader -> stage1 -> stage2 ... -> sink
+// 阶段之间通过有界 channel 连接，下游处理不过来时上游阻塞（背压）
+type Pipeline struct {
+	stages       []stage
+	queueSize    int
+	progressLog  int
+	drainTimeout time.Duration
+}
+
+func NewPipeline(queueSize int, progressLog int, drainTimeout time.Duration) *Pipeline {
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	return &Pipeline{queueSize: queueSize, progressLog: progressLog, drainTimeout: drainTimeout}
+}
+
+// 添加阶段，前面阶段失败的任务不会进入该阶段
+func (ths *Pipeline) Stage(name string, workers int, fn StageFunc) *Pipeline {
+	ths.stages = append(ths.stages, stage{name: name, workers: workers, fn: fn})
+	return ths
+}
+
+// 添加收尾阶段，失败的任务也会进入（用于落库、记录台账）
+func (ths *Pipeline) FinalStage(name string, workers int, fn StageFunc) *Pipeline {
+	ths.stages = append(ths.stages, stage{name: name, workers: workers, always: true, fn: fn})
+	return ths
+}
+
+// 运行流水线，阻塞直到所有任务流经全部阶段
+// ctx 取消后不再调度新任务，处理中的任务最多等待 drainTimeout 后取消
+func (ths *Pipeline) Run(ctx context.Context, source <-chan *Task) Summary {
+	start := time.Now()
+
+	workCtx, stop := DrainContext(ctx, ths.drainTimeout)
+	defer stop()
+
+	in := source
+	for _, s := range ths.stages {
+		in = ths.runStage(ctx, workCtx, s, in)
+	}
+
+	var summary Summary
+	for task := range in {
+		summary.Total++
+		switch {
+		case task.Err == nil:
+			summary.Succeeded++
+		case errors.Is(task.Err, ErrInterrupted):
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+		if ths.progressLog > 0 && summary.Total%int64(ths.progressLog) == 0 {
+			log.Infof("已处理 %d 当前第 %d 行 耗时 %d ms", summary.Total, task.Row, time.Since(start).Milliseconds())
+		}
+	}
+	summary.Interrupted = ctx.Err() != nil
+	summary.Elapsed = time.Since(start)
+	return summary
+}
+
+func (ths *Pipeline) runStage(ctx context.Context, workCtx context.Context, s stage, in <-chan *Task) <-chan *Task {
+	out := make(chan *Task, ths.queueSize)
+	workers := s.workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for task := range in {
+				// 中断后普通阶段不再开始新的处理
+				if task.Err == nil && !s.always && ctx.Err() != nil {
+					task.Err = ErrInterrupted
+				}
+				if task.Err == nil || s.always {
+					if err := s.fn(workCtx, task); err != nil && task.Err == nil {
+						task.Err = err
+					}
+				}
+				out <- task
+			}
+		}()
+	}
+
+	// 所有 worker 结束后关闭下游，保证屏障
+	go func() {
+		wg.Wait()
+		log.Debugf("Stage %s done", s.name)
+		close(out)
+	}()
+	return out
+}
+
+// 返回的 Context 在 parent 取消后继续保留 timeout 时长再取消，
+// 用于中断时让处理中的请求有机会完成
+func DrainContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-parent.Done():
+			log.Warnf("收到中断信号，停止调度新任务，等待处理中任务完成（最长 %s）", timeout)
+		case <-ctx.Done():
+			return
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			log.Warn("等待超时，取消处理中任务")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// 读取阶段，边读取边写入流水线，accept 不为空时只写入其返回 true 的任务
+// 每读取 progressLog 行输出一次进度；返回的 wait 等待读取结束并返回读取错误
+func TasksFrom(ctx context.Context, src Source, accept func(task *Task) bool, queueSize int, progressLog int) (<-chan *Task, func() error) {
+	out := make(chan *Task, queueSize)
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		defer close(out)
+		index := 0
+		err = src.Each(func(row int, file LoanFile) error {
+			index++
+			if progressLog > 0 && index%progressLog == 0 {
+				log.Infof("已读取 %d 条，当前第 %d 行", index, row)
+			}
+			task := &Task{Index: index - 1, Row: row, File: file}
+			if accept != nil && !accept(task) {
+				return nil
+			}
+			select {
+			case out <- task:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			err = nil
+		}
+	}()
+	return out, func() error {
+		<-done
+		return err
+	}
+}
@@ -0,0 +1,156 @@
+package loan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+)
+
+// 未限速时估算耗时使用的单次调用时长
+const estimatedCallLatency = time.Second
+
+// 各业务类型的统计
+type BusiTypePlan struct {
+	BusiType string `json:"busiType"`
+	Total    int    `json:"total"`
+	Pending  int    `json:"pending"`
+	Missing  int    `json:"missing"`
+}
+
+// 执行计划，只读数据库和本地文件，不访问 S3 和 ADV
+type Plan struct {
+	Download          bool            `json:"download"`
+	Total             int             `json:"total"`
+	Rejected          []Rejected      `json:"rejected"`
+	Processed         int             `json:"processed"`
+	Pending           int             `json:"pending"`
+	ByBusiType        []*BusiTypePlan `json:"byBusiType"`
+	Duplicates        []LoanFile      `json:"duplicates"`
+	Missing           []LoanFile      `json:"missing"`
+	EstimatedCalls    int             `json:"estimatedCalls"`
+	EstimatedDuration time.Duration   `json:"estimatedDuration"`
+	EstimatedDays     int             `json:"estimatedDays"`
+}
+
+// 生成 OCR 执行计划，download 为 true 时本地缺少的图片会先下载再识别
+func (ths *Service) PlanOcr(src Source, download bool) (*Plan, error) {
+	baseDir := config.App().Pdl.BaseDir
+	pending := newPendingFilter(ths.processedResults(), ths.loadOcrJobs())
+
+	plan := &Plan{Download: download}
+	byBusiType := map[string]*BusiTypePlan{}
+	busiTypePlan := func(busiType string) *BusiTypePlan {
+		p, ok := byBusiType[busiType]
+		if !ok {
+			p = &BusiTypePlan{BusiType: busiType}
+			byBusiType[busiType] = p
+			plan.ByBusiType = append(plan.ByBusiType, p)
+		}
+		return p
+	}
+
+	// 预览不写入校验未通过的报告，只统计行数
+	src.SetReport(false)
+	err := src.Each(func(row int, loan LoanFile) error {
+		p := busiTypePlan(loan.BusiType)
+		p.Total++
+		if !pending.accept(&Task{Row: row, File: loan}) {
+			return nil
+		}
+		p.Pending++
+		if !hasLocalImg(imgPath(baseDir, loan.InPath)) {
+			p.Missing++
+			plan.Missing = append(plan.Missing, loan)
+			if !download {
+				return nil
+			}
+		}
+		plan.EstimatedCalls++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Total = pending.total
+	plan.Rejected = src.Rejected()
+	plan.Processed = pending.done
+	plan.Pending = pending.pending
+	plan.Duplicates = pending.duplicates
+
+	sort.Slice(plan.ByBusiType, func(i, j int) bool {
+		return plan.ByBusiType[i].BusiType < plan.ByBusiType[j].BusiType
+	})
+
+	plan.estimate(config.App())
+	return plan, nil
+}
+
+// 按限速配置估算耗时
+func (ths *Plan) estimate(cfg *config.AppConfig) {
+	rateLimit := cfg.Pdl.AdvanceAI.RateLimit
+	calls := ths.EstimatedCalls
+
+	if rateLimit.DailyCap > 0 {
+		ths.EstimatedDays = (calls + rateLimit.DailyCap - 1) / rateLimit.DailyCap
+	}
+	if rateLimit.Qps > 0 {
+		ths.EstimatedDuration = time.Duration(float64(calls) / rateLimit.Qps * float64(time.Second))
+		return
+	}
+	workers := stageWorkers(cfg.Pdl.Pipeline.OcrWorkers)
+	if workers <= 0 {
+		workers = 1
+	}
+	ths.EstimatedDuration = time.Duration(calls) * estimatedCallLatency / time.Duration(workers)
+}
+
+func (ths *Plan) Print(w io.Writer) {
+	missing := "缺少图片"
+	if ths.Download {
+		missing = "待下载"
+	}
+	fmt.Fprintln(w, "----------------")
+	fmt.Fprintf(w, "总数 %d 校验未通过 %d 已处理 %d 待处理 %d 重复 %d %s %d\n",
+		ths.Total, len(ths.Rejected), ths.Processed, ths.Pending, len(ths.Duplicates), missing, len(ths.Missing))
+	for _, p := range ths.ByBusiType {
+		fmt.Fprintf(w, "  busiType %-8s 总数 %d 待处理 %d %s %d\n", p.BusiType, p.Total, p.Pending, missing, p.Missing)
+	}
+	fmt.Fprintf(w, "预计收费调用 %d 次，预计耗时 %s\n", ths.EstimatedCalls, ths.EstimatedDuration.Round(time.Second))
+	if ths.EstimatedDays > 1 {
+		fmt.Fprintf(w, "超过每日调用上限，预计需要 %d 天\n", ths.EstimatedDays)
+	}
+	for _, loan := range ths.Missing {
+		fmt.Fprintf(w, "  %s %s %s %s\n", missing, loan.CustNo, loan.BusiType, loan.InPath)
+	}
+	for _, r := range ths.Rejected {
+		fmt.Fprintf(w, "  校验未通过 第 %d 行 %s %s\n", r.Row, r.File.CustNo, r.Reason)
+	}
+	for _, loan := range ths.Duplicates {
+		fmt.Fprintf(w, "  重复 %s %s %s\n", loan.CustNo, loan.BusiType, loan.InPath)
+	}
+	fmt.Fprintln(w, "----------------")
+}
+
+// 耗时导出为可读的字符串，如 1h2m3s
+func (ths Plan) MarshalJSON() ([]byte, error) {
+	type plan Plan
+	return json.Marshal(struct {
+		plan
+		EstimatedDuration string `json:"estimatedDuration"`
+	}{plan(ths), ths.EstimatedDuration.Round(time.Second).String()})
+}
+
+// 导出为 JSON 文件
+func (ths *Plan) Export(filename string) error {
+	data, err := json.MarshalIndent(ths, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
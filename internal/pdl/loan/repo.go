@@ -0,0 +1,331 @@
+package loan
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 识别结果存储，每个客户每个业务类型一条
+type OcrResultRepo interface {
+	// 保存识别结果，已有结果时归档到历史后覆盖
+	Save(result *CuCustOcrResultDtl) error
+	// 某客户某业务类型的识别结果，没有时返回 nil
+	Latest(custNo string, busiType string) (*CuCustOcrResultDtl, error)
+	// 所有识别结果，key 为 custNo|busiType
+	LatestAll() (map[string]*CuCustOcrResultDtl, error)
+	// 被覆盖的历史结果，最近归档的在前
+	History(custNo string, busiType string) ([]*OcrResultHistory, error)
+}
+
+// 三方调用记录存储，每次调用三方服务一条，批处理只经发件箱上报，不直接写入
+type ThirdServiceRecordRepo interface {
+	Add(record *PointThirdServiceRecord) error
+	// 某次调用的记录
+	FindByTransactionId(transactionId string) ([]PointThirdServiceRecord, error)
+}
+
+// 埋点发件箱存储
+type EventOutboxRepo interface {
+	Add(event *EventOutbox) error
+	// 到期的待发送记录，按插入时间排序
+	Due(now time.Time, limit int) ([]EventOutbox, error)
+	Update(event *EventOutbox) error
+	// 未送达和已放弃的记录重置为待发送
+	Reset(now time.Time) error
+	// 未送达记录数
+	Undelivered() (int, error)
+}
+
+// OCR 任务台账存储
+type OcrJobRepo interface {
+	Create(job *OcrJob) error
+	Update(job *OcrJob) error
+	// 所有任务，key 为 custNo|busiType
+	All() (map[string]*OcrJob, error)
+	// 处理中的任务重置为待处理
+	ResetInFlight(now time.Time) error
+}
+
+// OCR 调用明细存储
+type OcrAttemptRepo interface {
+	Add(attempt *OcrAttempt) error
+	// 某时间之后发出的调用次数
+	CountSince(since time.Time) (int, error)
+	// 每个客户每个业务类型的收费调用次数，key 为 custNo|busiType
+	PaidCalls() (map[string]int, error)
+}
+
+// 按图片内容缓存的识别结果存储
+type ImageCacheRepo interface {
+	// 没有时返回 nil
+	Find(id string) (*OcrImageCache, error)
+	Save(cache *OcrImageCache) error
+	// 复用次数加一
+	Hit(id string, now time.Time) error
+}
+
+// 批处理使用的存储
+type Repos struct {
+	Results  OcrResultRepo
+	Records  ThirdServiceRecordRepo
+	Events   EventOutboxRepo
+	Jobs     OcrJobRepo
+	Attempts OcrAttemptRepo
+	Images   ImageCacheRepo
+}
+
+// 全部使用 db，表结构见 Migrate
+func NewGormRepos(db *gorm.DB) Repos {
+	return Repos{
+		Results:  NewGormOcrResultRepo(db),
+		Records:  NewGormThirdServiceRecordRepo(db),
+		Events:   NewGormEventOutboxRepo(db),
+		Jobs:     NewGormOcrJobRepo(db),
+		Attempts: NewGormOcrAttemptRepo(db),
+		Images:   NewGormImageCacheRepo(db),
+	}
+}
+
+type gormOcrResultRepo struct {
+	db *gorm.DB
+}
+
+func NewGormOcrResultRepo(db *gorm.DB) OcrResultRepo {
+	return &gormOcrResultRepo{db: db}
+}
+
+func (ths *gormOcrResultRepo) Save(result *CuCustOcrResultDtl) error {
+	err := ths.db.Transaction(func(tx *gorm.DB) error {
+		return upsertOcrResult(tx, result)
+	})
+	if err != nil && isDuplicateKey(err) {
+		// 并发写入同一客户，另一方已插入，重试转为更新
+		err = ths.db.Transaction(func(tx *gorm.DB) error {
+			return upsertOcrResult(tx, result)
+		})
+	}
+	return err
+}
+
+func upsertOcrResult(tx *gorm.DB, result *CuCustOcrResultDtl) error {
+	now := time.Now()
+	query := tx.Where("CUST_NO = ? AND BUSI_TYPE = ?", result.CustNo, result.BusiType)
+	if tx.Dialect().GetName() == "mysql" {
+		query = query.Set("gorm:query_option", "FOR UPDATE")
+	}
+	var existing CuCustOcrResultDtl
+	err := query.First(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		result.Id = result.GenerateUUID()
+		result.InstTime = now
+		result.UpdtTime = now
+		return tx.Create(result).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	history := newOcrResultHistory(&existing, now)
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+	result.Id = existing.Id
+	result.InstTime = existing.InstTime
+	result.UpdtTime = now
+	return tx.Save(result).Error
+}
+
+// MySQL 1062 或 SQLite 唯一约束冲突
+func isDuplicateKey(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "Duplicate entry") || strings.Contains(msg, "UNIQUE constraint failed")
+}
+
+func (ths *gormOcrResultRepo) Latest(custNo string, busiType string) (*CuCustOcrResultDtl, error) {
+	var result CuCustOcrResultDtl
+	err := ths.db.Where("CUST_NO = ? AND BUSI_TYPE = ?", custNo, busiType).First(&result).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (ths *gormOcrResultRepo) LatestAll() (map[string]*CuCustOcrResultDtl, error) {
+	var results []*CuCustOcrResultDtl
+	if err := ths.db.Order("UPDT_TIME").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	resultMap := make(map[string]*CuCustOcrResultDtl, len(results))
+	for _, result := range results {
+		resultMap[jobKey(result.CustNo, result.BusiType)] = result
+	}
+	return resultMap, nil
+}
+
+func (ths *gormOcrResultRepo) History(custNo string, busiType string) ([]*OcrResultHistory, error) {
+	var histories []*OcrResultHistory
+	err := ths.db.Where("CUST_NO = ? AND BUSI_TYPE = ?", custNo, busiType).
+		Order("ARCHIVED_TIME DESC").
+		Find(&histories).Error
+	return histories, err
+}
+
+type gormThirdServiceRecordRepo struct {
+	db *gorm.DB
+}
+
+func NewGormThirdServiceRecordRepo(db *gorm.DB) ThirdServiceRecordRepo {
+	return &gormThirdServiceRecordRepo{db: db}
+}
+
+func (ths *gormThirdServiceRecordRepo) Add(record *PointThirdServiceRecord) error {
+	return ths.db.Create(record).Error
+}
+
+func (ths *gormThirdServiceRecordRepo) FindByTransactionId(transactionId string) ([]PointThirdServiceRecord, error) {
+	var records []PointThirdServiceRecord
+	err := ths.db.Where("TRANSACTION_ID = ?", transactionId).Find(&records).Error
+	return records, err
+}
+
+type gormEventOutboxRepo struct {
+	db *gorm.DB
+}
+
+func NewGormEventOutboxRepo(db *gorm.DB) EventOutboxRepo {
+	return &gormEventOutboxRepo{db: db}
+}
+
+func (ths *gormEventOutboxRepo) Add(event *EventOutbox) error {
+	return ths.db.Create(event).Error
+}
+
+func (ths *gormEventOutboxRepo) Due(now time.Time, limit int) ([]EventOutbox, error) {
+	var events []EventOutbox
+	err := ths.db.Where("STATUS = ? AND NEXT_TIME <= ?", EventPending, now).
+		Order("INST_TIME").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (ths *gormEventOutboxRepo) Update(event *EventOutbox) error {
+	return ths.db.Save(event).Error
+}
+
+func (ths *gormEventOutboxRepo) Reset(now time.Time) error {
+	return ths.db.Model(&EventOutbox{}).Where("STATUS IN (?)", []string{EventPending, EventFailed}).
+		Updates(map[string]interface{}{"STATUS": EventPending, "ATTEMPTS": 0, "NEXT_TIME": now, "UPDT_TIME": now}).Error
+}
+
+func (ths *gormEventOutboxRepo) Undelivered() (int, error) {
+	var count int
+	err := ths.db.Model(&EventOutbox{}).Where("STATUS IN (?)", []string{EventPending, EventFailed}).Count(&count).Error
+	return count, err
+}
+
+type gormOcrJobRepo struct {
+	db *gorm.DB
+}
+
+func NewGormOcrJobRepo(db *gorm.DB) OcrJobRepo {
+	return &gormOcrJobRepo{db: db}
+}
+
+func (ths *gormOcrJobRepo) Create(job *OcrJob) error {
+	return ths.db.Create(job).Error
+}
+
+func (ths *gormOcrJobRepo) Update(job *OcrJob) error {
+	return ths.db.Save(job).Error
+}
+
+func (ths *gormOcrJobRepo) All() (map[string]*OcrJob, error) {
+	var jobs []*OcrJob
+	if err := ths.db.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	jobMap := make(map[string]*OcrJob, len(jobs))
+	for _, job := range jobs {
+		jobMap[jobKey(job.CustNo, job.BusiType)] = job
+	}
+	return jobMap, nil
+}
+
+func (ths *gormOcrJobRepo) ResetInFlight(now time.Time) error {
+	return ths.db.Model(&OcrJob{}).Where("STATUS = ?", JobInFlight).
+		Updates(map[string]interface{}{"STATUS": JobPending, "UPDT_TIME": now}).Error
+}
+
+type gormOcrAttemptRepo struct {
+	db *gorm.DB
+}
+
+func NewGormOcrAttemptRepo(db *gorm.DB) OcrAttemptRepo {
+	return &gormOcrAttemptRepo{db: db}
+}
+
+func (ths *gormOcrAttemptRepo) Add(attempt *OcrAttempt) error {
+	return ths.db.Create(attempt).Error
+}
+
+func (ths *gormOcrAttemptRepo) CountSince(since time.Time) (int, error) {
+	var count int
+	err := ths.db.Model(&OcrAttempt{}).Where("REQUEST_TIME >= ?", since).Count(&count).Error
+	return count, err
+}
+
+func (ths *gormOcrAttemptRepo) PaidCalls() (map[string]int, error) {
+	rows, err := ths.db.Model(&OcrAttempt{}).
+		Select("CUST_NO, BUSI_TYPE, COUNT(*)").
+		Where("IS_PAY = ?", "10000001").
+		Group("CUST_NO, BUSI_TYPE").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paidCalls := make(map[string]int)
+	for rows.Next() {
+		var custNo, busiType string
+		var count int
+		if err := rows.Scan(&custNo, &busiType, &count); err != nil {
+			return nil, err
+		}
+		paidCalls[jobKey(custNo, busiType)] = count
+	}
+	return paidCalls, rows.Err()
+}
+
+type gormImageCacheRepo struct {
+	db *gorm.DB
+}
+
+func NewGormImageCacheRepo(db *gorm.DB) ImageCacheRepo {
+	return &gormImageCacheRepo{db: db}
+}
+
+func (ths *gormImageCacheRepo) Find(id string) (*OcrImageCache, error) {
+	var cache OcrImageCache
+	err := ths.db.Where("ID = ?", id).First(&cache).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func (ths *gormImageCacheRepo) Save(cache *OcrImageCache) error {
+	return ths.db.Save(cache).Error
+}
+
+func (ths *gormImageCacheRepo) Hit(id string, now time.Time) error {
+	return ths.db.Model(&OcrImageCache{}).Where("ID = ?", id).
+		Updates(map[string]interface{}{"HITS": gorm.Expr("HITS + 1"), "UPDT_TIME": now}).Error
+}
@@ -0,0 +1,244 @@
+package loan_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+)
+
+// gorm 和内存实现行为一致
+func testOcrResultRepo(t *testing.T, repo loan.OcrResultRepo) {
+	first := loan.CuCustOcrResultDtl{CustNo: "C0170001", BusiType: "1", AdvCode: "SUCCESS", PanNo: "ABCPK1234F"}
+	if err := repo.Save(&first); err != nil {
+		t.Fatal(err)
+	}
+	second := loan.CuCustOcrResultDtl{CustNo: "C0170001", BusiType: "1", AdvCode: "SUCCESS", PanNo: "ABCPK1235F"}
+	if err := repo.Save(&second); err != nil {
+		t.Fatal(err)
+	}
+	if second.Id != first.Id || second.InstTime.Unix() != first.InstTime.Unix() {
+		t.Errorf("expected result %s kept, got %s", first.Id, second.Id)
+	}
+
+	latest, err := repo.Latest("C0170001", "1")
+	if err != nil || latest == nil || latest.PanNo != "ABCPK1235F" {
+		t.Fatalf("unexpected latest %#v %v", latest, err)
+	}
+	if missing, err := repo.Latest("C0170002", "1"); err != nil || missing != nil {
+		t.Errorf("expected no result, got %#v %v", missing, err)
+	}
+	all, err := repo.LatestAll()
+	if err != nil || len(all) != 1 || all["C0170001|1"].PanNo != "ABCPK1235F" {
+		t.Errorf("unexpected results %#v %v", all, err)
+	}
+	histories, err := repo.History("C0170001", "1")
+	if err != nil || len(histories) != 1 || histories[0].PanNo != "ABCPK1234F" || histories[0].ResultId != first.Id {
+		t.Errorf("unexpected histories %#v %v", histories, err)
+	}
+}
+
+func testThirdServiceRecordRepo(t *testing.T, repo loan.ThirdServiceRecordRepo) {
+	for _, id := range []string{"t1", "t1", "t2"} {
+		record := &loan.PointThirdServiceRecord{TransactionId: id, ServiceName: "ADV_OCR", ResponseCode: "SUCCESS"}
+		if err := repo.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := repo.FindByTransactionId("t1")
+	if err != nil || len(records) != 2 || records[0].ServiceName != "ADV_OCR" {
+		t.Errorf("unexpected records %#v %v", records, err)
+	}
+	if records, err := repo.FindByTransactionId("t3"); err != nil || len(records) != 0 {
+		t.Errorf("expected no records, got %#v %v", records, err)
+	}
+}
+
+func testEventOutboxRepo(t *testing.T, repo loan.EventOutboxRepo) {
+	now := time.Now().Truncate(time.Second)
+	for i, id := range []string{"e1", "e2", "e3"} {
+		event := &loan.EventOutbox{Id: id, InstTime: now.Add(time.Duration(i) * time.Second), CustNo: "C0180001",
+			Status: loan.EventPending, NextTime: now}
+		if err := repo.Add(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := repo.Due(now, 2)
+	if err != nil || len(due) != 2 || due[0].Id != "e1" || due[1].Id != "e2" {
+		t.Fatalf("unexpected due %#v %v", due, err)
+	}
+	due[0].Status = loan.EventDelivered
+	due[1].Status = loan.EventFailed
+	due[1].Attempts = 3
+	for i := range due {
+		if err := repo.Update(&due[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := repo.Undelivered(); err != nil || n != 2 {
+		t.Errorf("expected 2 undelivered, got %d %v", n, err)
+	}
+
+	if err := repo.Reset(now); err != nil {
+		t.Fatal(err)
+	}
+	due, err = repo.Due(now, 10)
+	if err != nil || len(due) != 2 || due[0].Id != "e2" || due[0].Attempts != 0 {
+		t.Errorf("unexpected due after reset %#v %v", due, err)
+	}
+}
+
+func testOcrJobRepo(t *testing.T, repo loan.OcrJobRepo) {
+	now := time.Now().Truncate(time.Second)
+	first := &loan.OcrJob{Id: "j1", InstTime: now, UpdtTime: now, CustNo: "C0210001", BusiType: "1", Status: loan.JobInFlight}
+	second := &loan.OcrJob{Id: "j2", InstTime: now, UpdtTime: now, CustNo: "C0210002", BusiType: "1", Status: loan.JobPending}
+	for _, job := range []*loan.OcrJob{first, second} {
+		if err := repo.Create(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second.Status = loan.JobSucceeded
+	second.Attempts = 1
+	if err := repo.Update(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ResetInFlight(now); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := repo.All()
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("unexpected jobs %#v %v", jobs, err)
+	}
+	if job := jobs["C0210001|1"]; job.Status != loan.JobPending {
+		t.Errorf("expected in-flight job reset, got %s", job.Status)
+	}
+	if job := jobs["C0210002|1"]; job.Status != loan.JobSucceeded || job.Attempts != 1 {
+		t.Errorf("unexpected job %#v", job)
+	}
+}
+
+func testOcrAttemptRepo(t *testing.T, repo loan.OcrAttemptRepo) {
+	now := time.Now().Truncate(time.Second)
+	attempts := []loan.OcrAttempt{
+		{Id: "a1", CustNo: "C0220001", BusiType: "1", RequestTime: now.Add(-time.Hour), IsPay: "10000001"},
+		{Id: "a2", CustNo: "C0220001", BusiType: "1", RequestTime: now, IsPay: "10000001"},
+		{Id: "a3", CustNo: "C0220002", BusiType: "1", RequestTime: now, IsPay: "10000002"},
+	}
+	for i := range attempts {
+		if err := repo.Add(&attempts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := repo.CountSince(now); err != nil || n != 2 {
+		t.Errorf("expected 2 attempts, got %d %v", n, err)
+	}
+	paidCalls, err := repo.PaidCalls()
+	if err != nil || len(paidCalls) != 1 || paidCalls["C0220001|1"] != 2 {
+		t.Errorf("unexpected paid calls %#v %v", paidCalls, err)
+	}
+}
+
+func testImageCacheRepo(t *testing.T, repo loan.ImageCacheRepo) {
+	if cache, err := repo.Find("h1|PAN_FRONT"); err != nil || cache != nil {
+		t.Errorf("expected no cache, got %#v %v", cache, err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	cache := &loan.OcrImageCache{Id: "h1|PAN_FRONT", InstTime: now, UpdtTime: now, ImageHash: "h1",
+		CardType: "PAN_FRONT", CustNo: "C0230001", Success: true, Fields: `{"idNumber":"ABCPK1234F"}`}
+	if err := repo.Save(cache); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.Hit(cache.Id, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := repo.Find(cache.Id)
+	if err != nil || found == nil || found.Hits != 2 || found.CustNo != "C0230001" || found.Fields != cache.Fields {
+		t.Errorf("unexpected cache %#v %v", found, err)
+	}
+}
+
+func testRepos(t *testing.T, repos loan.Repos) {
+	testOcrResultRepo(t, repos.Results)
+	testThirdServiceRecordRepo(t, repos.Records)
+	testEventOutboxRepo(t, repos.Events)
+	testOcrJobRepo(t, repos.Jobs)
+	testOcrAttemptRepo(t, repos.Attempts)
+	testImageCacheRepo(t, repos.Images)
+}
+
+func TestGormRepos(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	_, db := setup(t, server)
+
+	testRepos(t, loan.NewGormRepos(db))
+}
+
+func TestMemoryRepos(t *testing.T) {
+	testRepos(t, loan.NewMemoryRepos())
+}
+
+// 全部使用内存存储，不连接数据库
+func TestBatchWithMemoryRepos(t *testing.T) {
+	events := newEventServer()
+	defer events.Close()
+	cfg := &config.App().Pdl.EventServer
+	saved := *cfg
+	cfg.ThirdUrl = events.URL
+	defer func() { *cfg = saved }()
+
+	server := advancetest.NewServer()
+	defer server.Close()
+
+	repos := loan.NewMemoryRepos()
+	svc := loan.NewService(repos, nil, newSelector(server))
+
+	excelPath := writeExcel(t, "C0190001", "C0190002")
+	summary := svc.BatchReqAdvIdCardOcr(context.Background(), loan.NewExcelSource(excelPath))
+	if summary.Total != 2 || summary.Succeeded != 2 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	if all, _ := repos.Results.LatestAll(); len(all) != 2 {
+		t.Errorf("expected 2 results, got %d", len(all))
+	}
+	jobs, err := repos.Jobs.All()
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("unexpected jobs %#v %v", jobs, err)
+	}
+	for key, job := range jobs {
+		if job.Status != loan.JobSucceeded {
+			t.Errorf("expected job %s succeeded, got %s", key, job.Status)
+		}
+		// 三方调用记录只通过埋点上报，不在本地落库
+		if records, _ := repos.Records.FindByTransactionId(job.TransactionId); len(records) != 0 {
+			t.Errorf("expected no local record for job %s, got %d", key, len(records))
+		}
+	}
+	if n, _ := repos.Attempts.CountSince(time.Now().Add(-time.Hour)); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+	if n, _ := repos.Events.Undelivered(); n != 0 {
+		t.Errorf("expected all events delivered, got %d undelivered", n)
+	}
+	if got := len(events.received()); got != 2 {
+		t.Errorf("expected 2 requests, got %d", got)
+	}
+
+	// 已有结果的客户不再处理
+	if plan, err := svc.PlanOcr(loan.NewExcelSource(excelPath), false); err != nil || plan.Pending != 0 {
+		t.Errorf("unexpected plan %#v %v", plan, err)
+	}
+}
@@ -0,0 +1,164 @@
+package loan
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+	uuid "github.com/satori/go.uuid"
+)
+
+// 被覆盖的历史识别结果，每次重新识别归档一条
+type OcrResultHistory struct {
+	Id           string    `json:"id" gorm:"primary_key;type:varchar(40);comment:'ID'"`
+	ResultId     string    `json:"resultId" gorm:"column:RESULT_ID;type:varchar(40);comment:'对应识别结果ID'"`
+	ArchivedTime time.Time `json:"archivedTime" gorm:"column:ARCHIVED_TIME;type:datetime;comment:'归档时间'"`
+	InstTime     time.Time `json:"instTime" gorm:"column:INST_TIME;type:datetime;comment:'插入时间'"`
+	UpdtTime     time.Time `json:"updtTime" gorm:"column:UPDT_TIME;type:datetime;comment:'修改时间'"`
+	InstUserNo   string    `json:"instUserNo" gorm:"column:INST_USER_NO;type:varchar(40);comment:'插入用户编码'"`
+	UpdtUserNo   string    `json:"updtUserNo" gorm:"column:UPDT_USER_NO;type:varchar(40);comment:'修改用户编码'"`
+	Remark       string    `json:"REMARK" gorm:"column:REMARK;type:varchar(400);comment:'备注（修改记录）'"`
+	CustNo       string    `json:"custNo" gorm:"column:CUST_NO;type:varchar(40);index:idx_ocr_his_cust_busi;comment:'客户唯一编码'"`
+	BusiType     string    `json:"busiType" gorm:"column:BUSI_TYPE;type:varchar(40);index:idx_ocr_his_cust_busi;comment:'业务类型（码类：1007）'"`
+	AdvCode      string    `json:"advCode" gorm:"column:ADV_CODE;type:varchar(200);comment:'ADV返回code'"`
+	Message      string    `json:"message" gorm:"column:MESSAGE;type:varchar(200);comment:'ADV返回message'"`
+	PanNo        string    `json:"panNo" gorm:"column:PAN_NO;type:varchar(200);comment:'Pan卡编号（加密）'"`
+	CustName     string    `json:"custName" gorm:"column:CUST_NAME;type:varchar(500);comment:'客户姓名（加密）'"`
+	Birthday     string    `json:"birthday" gorm:"column:BIRTHDAY;type:varchar(200);comment:'生日（加密）'"`
+	FatherName   string    `json:"fatherName" gorm:"column:FATHER_NAME;type:varchar(500);comment:'父亲姓名（加密）'"`
+	CardType     string    `json:"cardType" gorm:"column:CARD_TYPE;type:varchar(40);comment:'证件类型'"`
+	Gender       string    `json:"gender" gorm:"column:GENDER;type:varchar(20);comment:'性别'"`
+	Address      string    `json:"address" gorm:"column:ADDRESS;type:text;comment:'地址（加密）'"`
+	ExtraInfo    string    `json:"extraInfo" gorm:"column:EXTRA_INFO;type:text;comment:'证件其他字段（JSON，加密）'"`
+
+	BirthDate     *time.Time `json:"birthDate" gorm:"-"`
+	VerifyStatus  string     `json:"verifyStatus" gorm:"column:VERIFY_STATUS;type:varchar(20);comment:'校验状态'"`
+	VerifyMessage string     `json:"verifyMessage" gorm:"column:VERIFY_MESSAGE;type:varchar(400);comment:'校验未通过原因'"`
+
+	BirthDateText string `json:"-" gorm:"column:BIRTH_DATE;type:varchar(200);comment:'解析后的出生日期（yyyy-MM-dd，加密）'"`
+}
+
+func (OcrResultHistory) TableName() string {
+	return "cu_cust_ocr_result_his"
+}
+
+func newOcrResultHistory(result *CuCustOcrResultDtl, archivedTime time.Time) OcrResultHistory {
+	return OcrResultHistory{
+		Id:            uuid.Must(uuid.NewV4(), nil).String(),
+		ResultId:      result.Id,
+		ArchivedTime:  archivedTime,
+		InstTime:      result.InstTime,
+		UpdtTime:      result.UpdtTime,
+		InstUserNo:    result.InstUserNo,
+		UpdtUserNo:    result.UpdtUserNo,
+		Remark:        result.Remark,
+		CustNo:        result.CustNo,
+		BusiType:      result.BusiType,
+		AdvCode:       result.AdvCode,
+		Message:       result.Message,
+		PanNo:         result.PanNo,
+		CustName:      result.CustName,
+		Birthday:      result.Birthday,
+		FatherName:    result.FatherName,
+		CardType:      result.CardType,
+		Gender:        result.Gender,
+		Address:       result.Address,
+		ExtraInfo:     result.ExtraInfo,
+		BirthDate:     result.BirthDate,
+		VerifyStatus:  result.VerifyStatus,
+		VerifyMessage: result.VerifyMessage,
+	}
+}
+
+func (ths *OcrResultHistory) piiFields() []*string {
+	return []*string{&ths.PanNo, &ths.CustName, &ths.Birthday, &ths.FatherName, &ths.Address, &ths.ExtraInfo, &ths.BirthDateText}
+}
+
+func (ths *OcrResultHistory) BeforeSave() error {
+	ths.BirthDateText = formatBirthDate(ths.BirthDate)
+	c, err := piiCipher()
+	if c == nil {
+		return err
+	}
+	return encryptFields(c, ths.piiFields()...)
+}
+
+func (ths *OcrResultHistory) AfterSave() error {
+	return ths.AfterFind()
+}
+
+func (ths *OcrResultHistory) AfterFind() error {
+	c, err := piiCipher()
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		if err := decryptFields(c, ths.piiFields()...); err != nil {
+			return err
+		}
+	}
+	ths.BirthDate = parseBirthDate(ths.BirthDateText, ths.Birthday)
+	return nil
+}
+
+// 建唯一索引前归档重复的结果，每组保留最新一条
+func dedupeOcrResults(db *gorm.DB) error {
+	if !db.HasTable(&CuCustOcrResultDtl{}) {
+		return nil
+	}
+	rows, err := db.Model(&CuCustOcrResultDtl{}).
+		Select("CUST_NO, BUSI_TYPE").
+		Group("CUST_NO, BUSI_TYPE").
+		Having("COUNT(*) > 1").
+		Rows()
+	if err != nil {
+		return err
+	}
+	var keys [][2]string
+	for rows.Next() {
+		var custNo, busiType string
+		if err := rows.Scan(&custNo, &busiType); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, [2]string{custNo, busiType})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	archived := 0
+	for _, key := range keys {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var results []*CuCustOcrResultDtl
+			if err := tx.Where("CUST_NO = ? AND BUSI_TYPE = ?", key[0], key[1]).
+				Order("UPDT_TIME DESC, INST_TIME DESC").
+				Find(&results).Error; err != nil {
+				return err
+			}
+			if len(results) < 2 {
+				return nil
+			}
+			now := time.Now()
+			for _, result := range results[1:] {
+				history := newOcrResultHistory(result, now)
+				if err := tx.Create(&history).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("id = ?", result.Id).Delete(&CuCustOcrResultDtl{}).Error; err != nil {
+					return err
+				}
+				archived++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if archived > 0 {
+		log.Infof("归档重复的识别结果 %d 条，涉及 %d 个客户", archived, len(keys))
+	}
+	return nil
+}
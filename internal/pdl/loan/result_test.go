@@ -0,0 +1,80 @@
+package loan_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+)
+
+func TestUpsertOcrResult(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	first := loan.CuCustOcrResultDtl{CustNo: "C0150001", BusiType: "1", AdvCode: "SUCCESS", PanNo: "ABCPK1234F", CustName: "RAVI KUMAR"}
+	if err := svc.UpsertOcrResult(&first); err != nil {
+		t.Fatal(err)
+	}
+	second := loan.CuCustOcrResultDtl{CustNo: "C0150001", BusiType: "1", AdvCode: "SUCCESS", PanNo: "ABCPK1235F", CustName: "RAVI KUMAR"}
+	if err := svc.UpsertOcrResult(&second); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, db, &loan.CuCustOcrResultDtl{}); n != 1 {
+		t.Fatalf("expected 1 result, got %d", n)
+	}
+	latest, err := svc.LatestOcrResult("C0150001", "1")
+	if err != nil || latest == nil || latest.PanNo != "ABCPK1235F" {
+		t.Fatalf("unexpected latest %#v %v", latest, err)
+	}
+	histories, err := svc.OcrResultHistoryOf("C0150001", "1")
+	if err != nil || len(histories) != 1 {
+		t.Fatalf("unexpected histories %#v %v", histories, err)
+	}
+	if histories[0].PanNo != "ABCPK1234F" || histories[0].ResultId != latest.Id {
+		t.Errorf("unexpected history %#v", histories[0])
+	}
+
+	if missing, err := svc.LatestOcrResult("C0150002", "1"); err != nil || missing != nil {
+		t.Errorf("expected no result, got %#v %v", missing, err)
+	}
+}
+
+func TestMigrateDedupesOcrResults(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	svc, db := setup(t, server)
+
+	// 模拟唯一索引之前写入的重复结果
+	if err := db.Model(&loan.CuCustOcrResultDtl{}).RemoveIndex("uk_ocr_cust_busi").Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, pan := range []string{"ABCPK1234F", "ABCPK1235F", "ABCPK1236F"} {
+		result := loan.CuCustOcrResultDtl{Id: pan, CustNo: "C0160001", BusiType: "1", AdvCode: "SUCCESS", PanNo: pan,
+			InstTime: now, UpdtTime: now.Add(time.Duration(i) * time.Minute)}
+		if err := db.Create(&result).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := loan.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	results, err := svc.LatestOcrResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results["C0160001|1"].PanNo != "ABCPK1236F" {
+		t.Fatalf("unexpected results %#v", results)
+	}
+	if n := count(t, db, &loan.OcrResultHistory{}); n != 2 {
+		t.Errorf("expected 2 histories, got %d", n)
+	}
+	duplicate := loan.CuCustOcrResultDtl{Id: "dup", CustNo: "C0160001", BusiType: "1", AdvCode: "SUCCESS"}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Error("expected unique key violation")
+	}
+}
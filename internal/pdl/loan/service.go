@@ -0,0 +1,105 @@
+package loan
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+	uuid "github.com/satori/go.uuid"
+)
+
+// 图片下载器，见 pugaws.S3Downloader
+type Downloader interface {
+	// 下载到 baseDir 下与 key 相同的路径
+	BatchDownload(ctx context.Context, baseDir string, keys []string) error
+	// 下载到内存
+	Download(ctx context.Context, key string) ([]byte, error)
+}
+
+// 批处理服务，存储、下载器和 OCR 服务商由调用方注入
+type Service struct {
+	repos      Repos
+	downloader Downloader
+	providers  *ocr.Selector
+	httpClient *http.Client
+}
+
+// downloader 只在下载时使用，providers 只在识别时使用，不需要时可为 nil
+func NewService(repos Repos, downloader Downloader, providers *ocr.Selector) *Service {
+	return &Service{repos: repos, downloader: downloader, providers: providers, httpClient: http.DefaultClient}
+}
+
+// 替换埋点等对外调用使用的客户端，通常为 pughttp.New 创建的共享客户端
+func (ths *Service) SetHTTPClient(client *http.Client) {
+	ths.httpClient = client
+}
+
+// 只保存识别成功的结果，重新识别时覆盖并归档旧结果
+func (ths *Service) SaveResult(result CuCustOcrResultDtl) error {
+	if "SUCCESS" != result.AdvCode {
+		return nil
+	}
+	return ths.repos.Results.Save(&result)
+}
+
+// 已有 OCR 结果，key 为 custNo|busiType
+func (ths *Service) processedResults() map[string]string {
+	results, err := ths.repos.Results.LatestAll()
+	if err != nil {
+		log.Errorf("Load ocr results err: %s", err)
+		return nil
+	}
+	processedMap := make(map[string]string, len(results))
+	for key, result := range results {
+		processedMap[key] = result.AdvCode
+	}
+	return processedMap
+}
+
+// 三方调用记录写入发件箱，等待发送，记录表由埋点服务落库
+func (ths *Service) AddRecord(file *LoanFile, record PointThirdServiceRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return ths.repos.Events.Add(&EventOutbox{
+		Id:            uuid.Must(uuid.NewV4(), nil).String(),
+		InstTime:      now,
+		UpdtTime:      now,
+		CustNo:        file.CustNo,
+		BusiType:      file.BusiType,
+		TransactionId: record.TransactionId,
+		Payload:       string(payload),
+		Status:        EventPending,
+		NextTime:      now,
+	})
+}
+
+// 保存识别结果，见 OcrResultRepo.Save
+func (ths *Service) UpsertOcrResult(result *CuCustOcrResultDtl) error {
+	return ths.repos.Results.Save(result)
+}
+
+// 某客户某业务类型的识别结果，没有时返回 nil
+func (ths *Service) LatestOcrResult(custNo string, busiType string) (*CuCustOcrResultDtl, error) {
+	return ths.repos.Results.Latest(custNo, busiType)
+}
+
+// 每个客户每个业务类型最新的识别结果，key 为 custNo|busiType
+func (ths *Service) LatestOcrResults() (map[string]*CuCustOcrResultDtl, error) {
+	return ths.repos.Results.LatestAll()
+}
+
+// 某客户某业务类型被覆盖的历史结果，最近归档的在前
+func (ths *Service) OcrResultHistoryOf(custNo string, busiType string) ([]*OcrResultHistory, error) {
+	return ths.repos.Results.History(custNo, busiType)
+}
+
+// 未送达埋点数
+func (ths *Service) UndeliveredEvents() (int, error) {
+	return ths.repos.Events.Undelivered()
+}
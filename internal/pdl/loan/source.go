@@ -0,0 +1,351 @@
+package loan
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/pkg/excel"
+	log "github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/onlythinking/pug-go/pkg/oss/pugaws"
+)
+
+// 数据来源类型
+const (
+	SourceExcel = "excel"
+	SourceCsv   = "csv"
+	SourceJsonl = "jsonl"
+	SourceSql   = "sql"
+)
+
+// 批次数据来源，逐行读取
+type Source interface {
+	// 依次读取通过校验的数据，row 为源数据中的行号，fn 返回错误时停止读取并返回该错误
+	Each(fn func(row int, file LoanFile) error) error
+	// 从第 row 行开始读取（从 1 开始，含表头）
+	StartFrom(row int)
+	// 是否写入校验未通过的报告，默认写入
+	SetReport(enabled bool)
+	// 上次读取时校验未通过的行
+	Rejected() []Rejected
+	// 用于日志
+	String() string
+}
+
+// 读取全部数据
+func LoadAll(src Source) ([]LoanFile, error) {
+	var loans []LoanFile
+	err := src.Each(func(row int, file LoanFile) error {
+		loans = append(loans, file)
+		return nil
+	})
+	return loans, err
+}
+
+// 按类型打开数据来源，kind 为空时按文件扩展名判断
+// sql 类型的 location 为 .sql 文件或查询语句，在 db 中执行，其他类型不使用 db
+func OpenSource(db *gorm.DB, kind string, location string) (Source, error) {
+	if kind == "" {
+		kind = sourceKind(location)
+	}
+	switch kind {
+	case SourceExcel:
+		return NewExcelSource(location), nil
+	case SourceCsv:
+		return NewCsvSource(location), nil
+	case SourceJsonl:
+		return NewJsonlSource(location), nil
+	case SourceSql:
+		if db == nil {
+			return nil, fmt.Errorf("sql source %s requires a database", location)
+		}
+		query := location
+		if strings.EqualFold(filepath.Ext(location), ".sql") {
+			data, err := ioutil.ReadFile(location)
+			if err != nil {
+				return nil, err
+			}
+			query = string(data)
+		}
+		return NewQuerySource(db, query), nil
+	}
+	return nil, fmt.Errorf("unknown source %q of %s", kind, location)
+}
+
+func sourceKind(location string) string {
+	switch strings.ToLower(filepath.Ext(location)) {
+	case ".xlsx":
+		return SourceExcel
+	case ".csv":
+		return SourceCsv
+	case ".jsonl", ".ndjson":
+		return SourceJsonl
+	case ".sql":
+		return SourceSql
+	}
+	return ""
+}
+
+var (
+	refsOnce sync.Once
+	refs     *pugaws.URLParser
+)
+
+// 图片地址解析器，按 Oss.DefaultBucket 和 Oss.DomainUrl 创建
+func imgRefs() *pugaws.URLParser {
+	refsOnce.Do(func() {
+		parser, err := pugaws.NewURLParserFromConfig()
+		if err != nil {
+			log.Errorf("oss.domainUrl err: %s", err)
+			parser, _ = pugaws.NewURLParser(config.App().Oss.DefaultBucket)
+		}
+		refs = parser
+	})
+	return refs
+}
+
+// 图片的本地路径，其他桶的图片放在以桶名命名的目录下
+func imgPath(baseDir string, inPath string) string {
+	return filepath.Join(baseDir, imgRefs().LocalPath(inPath))
+}
+
+// 图片地址统一为默认桶的 key 或 s3://bucket/key，无法解析时保持原样由校验拒绝
+func normalizeLoanFile(file LoanFile) LoanFile {
+	if key, err := imgRefs().Normalize(file.InPath); err == nil {
+		file.InPath = key
+	}
+	return file
+}
+
+// Excel 第一个 sheet，按表头映射列，流式读取
+type ExcelSource struct {
+	sourceBase
+	filename string
+}
+
+func NewExcelSource(filename string) *ExcelSource {
+	return &ExcelSource{filename: filename}
+}
+
+func (ths *ExcelSource) Each(fn func(row int, file LoanFile) error) error {
+	reader, err := excel.Open(ths.filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	parser, err := newTableParser(ths.startRow)
+	if err != nil {
+		return err
+	}
+	defer func() { ths.report(ths, ths.filename, parser.rejected) }()
+
+	for {
+		row, cells, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", ths.filename, err)
+		}
+		file, ok, err := parser.add(row, cells)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ths.filename, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(row, file); err != nil {
+			return err
+		}
+	}
+}
+
+func (ths *ExcelSource) String() string {
+	return "excel " + ths.filename
+}
+
+// CSV 文件，按表头映射列
+type CsvSource struct {
+	sourceBase
+	filename string
+}
+
+func NewCsvSource(filename string) *CsvSource {
+	return &CsvSource{filename: filename}
+}
+
+func (ths *CsvSource) Each(fn func(row int, file LoanFile) error) error {
+	f, err := os.Open(ths.filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	parser, err := newTableParser(ths.startRow)
+	if err != nil {
+		return err
+	}
+	defer func() { ths.report(ths, ths.filename, parser.rejected) }()
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		file, ok, err := parser.add(row, record)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ths.filename, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(row, file); err != nil {
+			return err
+		}
+	}
+}
+
+func (ths *CsvSource) String() string {
+	return "csv " + ths.filename
+}
+
+// JSON Lines 文件，每行一个 LoanFile
+type JsonlSource struct {
+	sourceBase
+	filename string
+}
+
+func NewJsonlSource(filename string) *JsonlSource {
+	return &JsonlSource{filename: filename}
+}
+
+func (ths *JsonlSource) Each(fn func(row int, file LoanFile) error) error {
+	f, err := os.Open(ths.filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	validator, err := newValidator()
+	if err != nil {
+		return err
+	}
+	parser := &tableParser{validator: validator}
+	defer func() { ths.report(ths, ths.filename, parser.rejected) }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line < ths.startRow || text == "" {
+			continue
+		}
+		var row LoanFile
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			parser.reject(line, err.Error(), LoanFile{})
+			continue
+		}
+		file, ok := parser.check(line, row)
+		if !ok {
+			continue
+		}
+		if err := fn(line, file); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (ths *JsonlSource) String() string {
+	return "jsonl " + ths.filename
+}
+
+// 在业务库执行查询，结果列按名称匹配（忽略大小写和下划线）：
+// cust_no, busi_type, in_path, app_no, phone_no
+// 行号为结果集中的序号
+type QuerySource struct {
+	sourceBase
+	db    *gorm.DB
+	query string
+}
+
+func NewQuerySource(db *gorm.DB, query string) *QuerySource {
+	return &QuerySource{db: db, query: query}
+}
+
+func (ths *QuerySource) Each(fn func(row int, file LoanFile) error) error {
+	validator, err := newValidator()
+	if err != nil {
+		return err
+	}
+
+	rows, err := ths.db.Raw(ths.query).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	mapping, err := NewColumnMapping(columns, config.App().Pdl.Input.Columns)
+	if err != nil {
+		return err
+	}
+	if mapping == nil {
+		return fmt.Errorf("query result has no cust_no or in_path column: %v", columns)
+	}
+
+	parser := &tableParser{validator: validator, mapping: mapping}
+	defer func() { ths.report(ths, "", parser.rejected) }()
+
+	cells := make([]sql.NullString, len(columns))
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = &cells[i]
+	}
+	record := make([]string, len(columns))
+	for row := 1; rows.Next(); row++ {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+		if row < ths.startRow {
+			continue
+		}
+		for i, cell := range cells {
+			record[i] = cell.String
+		}
+		file, ok := parser.check(row, mapping.LoanFile(record))
+		if !ok {
+			continue
+		}
+		if err := fn(row, file); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (ths *QuerySource) String() string {
+	return "sql " + ths.query
+}
@@ -0,0 +1,226 @@
+package loan_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/onlythinking/pug-go/internal/pdl/advance/advancetest"
+	"github.com/onlythinking/pug-go/internal/pdl/loan"
+	"github.com/tealeg/xlsx/v3"
+)
+
+var wantLoans = []loan.LoanFile{
+	{CustNo: "C0060001", BusiType: "1", InPath: "pan/C0060001.jpg", AppNo: "001", PhoneNo: "9876543210"},
+	{CustNo: "C0060002", BusiType: "2", InPath: "pan/C0060002.jpg", AppNo: "001", PhoneNo: ""},
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func load(t *testing.T, db *gorm.DB, kind string, location string) []loan.LoanFile {
+	t.Helper()
+	src, err := loan.OpenSource(db, kind, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loans, err := loan.LoadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loans
+}
+
+func TestCsvSource(t *testing.T) {
+	filename := writeFile(t, "pan.csv", `custNo,busiType,inPath,appNo,phoneNo
+C0060001,1,https://qt-fpdl-app.s3.ap-south-1.amazonaws.com/pan/C0060001.jpg,001,9876543210
+C0060003,1,,001,9876543210
+C0060002,2,https://s3.ap-south-1.amazonaws.com/qt-fpdl-app/pan/C0060002.jpg,001
+`)
+	if got := load(t, nil, "", filename); !reflect.DeepEqual(got, wantLoans) {
+		t.Errorf("expected %#v, got %#v", wantLoans, got)
+	}
+}
+
+func TestJsonlSource(t *testing.T) {
+	filename := writeFile(t, "pan.jsonl", `{"custNo":"C0060001","busiType":"1","inPath":"pan/C0060001.jpg","appNo":"001","phoneNo":"9876543210"}
+
+{"custNo":"C0060002","busiType":"2","inPath":"pan/C0060002.jpg","appNo":"001"}
+`)
+	if got := load(t, nil, "", filename); !reflect.DeepEqual(got, wantLoans) {
+		t.Errorf("expected %#v, got %#v", wantLoans, got)
+	}
+
+	bad := writeFile(t, "bad.jsonl", "{\"custNo\":\"C0060001\",\"busiType\":\"1\",\"inPath\":\"pan/C0060001.jpg\"}\n{oops}\n")
+	src, err := loan.OpenSource(nil, loan.SourceJsonl, bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loans, err := loan.LoadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loans) != 1 || len(src.Rejected()) != 1 || src.Rejected()[0].Row != 2 {
+		t.Errorf("unexpected loans %#v rejected %#v", loans, src.Rejected())
+	}
+}
+
+func TestQuerySource(t *testing.T) {
+	server := advancetest.NewServer()
+	defer server.Close()
+	_, db := setup(t, server)
+
+	statements := []string{
+		`CREATE TABLE cu_cust_img (CUST_NO varchar(40), BUSI_TYPE varchar(8), IMG_URL varchar(400), APP_NO varchar(8), PHONE_NO varchar(20), REGIST_DATE varchar(10))`,
+		`INSERT INTO cu_cust_img VALUES ('C0060001', '1', 'pan/C0060001.jpg', '001', '9876543210', '2021-06-01')`,
+		`INSERT INTO cu_cust_img VALUES ('C0060002', '2', 'pan/C0060002.jpg', '001', NULL, '2021-06-01')`,
+		`INSERT INTO cu_cust_img VALUES ('C0060003', '1', 'pan/C0060003.jpg', '001', '9876543210', '2021-05-31')`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := `SELECT CUST_NO, BUSI_TYPE, IMG_URL AS IN_PATH, APP_NO, PHONE_NO FROM cu_cust_img
+WHERE REGIST_DATE = '2021-06-01' ORDER BY CUST_NO`
+	if got := load(t, db, loan.SourceSql, query); !reflect.DeepEqual(got, wantLoans) {
+		t.Errorf("expected %#v, got %#v", wantLoans, got)
+	}
+	if got := load(t, db, "", writeFile(t, "yesterday.sql", query)); !reflect.DeepEqual(got, wantLoans) {
+		t.Errorf("expected %#v, got %#v", wantLoans, got)
+	}
+
+	src, err := loan.OpenSource(db, loan.SourceSql, "SELECT CUST_NO FROM cu_cust_img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loan.LoadAll(src); err == nil {
+		t.Error("expected error for query without in_path column")
+	}
+}
+
+func TestExcelHeaderMapping(t *testing.T) {
+	wb := xlsx.NewFile()
+	sh, err := wb.AddSheet("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 列顺序与默认不同，使用别名，带有无关列
+	addRow(sh, "Mobile", "Remark", "Image URL", "CUST_NO", "Business Type", "App No")
+	addRow(sh, "9876543210", "ok", "https://qt-fpdl-app.s3.ap-south-1.amazonaws.com/pan/C0060001.jpg", "C0060001", "1", "001")
+	addRow(sh, "", "", "pan/C0060002.jpg", "C0060002", "2", "001")
+	addRow(sh, "", "", "", "", "", "")
+	addRow(sh, "12345", "bad phone", "pan/C0060003.jpg", "C0060003", "1", "001")
+	addRow(sh, "", "bad custNo", "pan/C-3.jpg", "C-3", "1", "001")
+	addRow(sh, "", "no busiType", "pan/C0060004.jpg", "C0060004", "", "001")
+	addRow(sh, "", "no inPath", "", "C0060005", "1", "001")
+	addRow(sh, "", "unknown host", "https://example.com/C0060006.jpg", "C0060006", "1", "001")
+	addRow(sh, "", "escape", "../C0060007.jpg", "C0060007", "1", "001")
+	excelPath := filepath.Join(t.TempDir(), "pan.xlsx")
+	if err := wb.Save(excelPath); err != nil {
+		t.Fatal(err)
+	}
+
+	src := loan.NewExcelSource(excelPath)
+	loans, err := loan.LoadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loans, wantLoans) {
+		t.Errorf("expected %#v, got %#v", wantLoans, loans)
+	}
+
+	rows := map[int]string{5: "phoneNo", 6: "custNo", 7: "busiType", 8: "inPath", 9: "inPath", 10: "inPath"}
+	rejected := src.Rejected()
+	if len(rejected) != len(rows) {
+		t.Fatalf("expected %d rejected rows, got %#v", len(rows), rejected)
+	}
+	for _, r := range rejected {
+		if field, ok := rows[r.Row]; !ok || !strings.Contains(r.Reason, field) {
+			t.Errorf("unexpected rejected row %#v", r)
+		}
+	}
+
+	report, err := ioutil.ReadFile(strings.TrimSuffix(excelPath, ".xlsx") + ".rejected.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(report)), "\n"); len(lines) != len(rows)+1 ||
+		!strings.HasPrefix(lines[1], "5,") {
+		t.Errorf("unexpected report %s", report)
+	}
+}
+
+func TestSourceStartFrom(t *testing.T) {
+	filename := writeFile(t, "pan.csv", `custNo,busiType,inPath
+C0060001,1,pan/C0060001.jpg
+bad,1,pan/bad.jpg
+C0060002,1,pan/C0060002.jpg
+C0060003,1,pan/C0060003.jpg
+`)
+	// 完整运行写入校验未通过的报告
+	if _, err := loan.LoadAll(loan.NewCsvSource(filename)); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := strings.TrimSuffix(filename, ".csv") + ".rejected.csv"
+	if _, err := os.Stat(reportPath); err != nil {
+		t.Fatal(err)
+	}
+
+	src := loan.NewCsvSource(filename)
+	src.StartFrom(4)
+
+	var rows []int
+	err := src.Each(func(row int, file loan.LoanFile) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows, []int{4, 5}) {
+		t.Errorf("expected rows [4 5], got %v", rows)
+	}
+	if len(src.Rejected()) != 0 {
+		t.Errorf("expected rows before start not validated, got %#v", src.Rejected())
+	}
+	// 续跑没有校验未通过的行，保留之前的报告
+	if report, err := ioutil.ReadFile(reportPath); err != nil || !strings.Contains(string(report), "bad") {
+		t.Errorf("expected report kept, got %s %v", report, err)
+	}
+}
+
+func TestExcelMissingColumn(t *testing.T) {
+	wb := xlsx.NewFile()
+	sh, err := wb.AddSheet("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addRow(sh, "custNo", "busiType", "appNo")
+	addRow(sh, "C0060001", "1", "001")
+	excelPath := filepath.Join(t.TempDir(), "pan.xlsx")
+	if err := wb.Save(excelPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loan.LoadAll(loan.NewExcelSource(excelPath)); err == nil || !strings.Contains(err.Error(), "inPath") {
+		t.Errorf("expected missing inPath column error, got %v", err)
+	}
+}
+
+func TestOpenSourceUnknown(t *testing.T) {
+	if _, err := loan.OpenSource(nil, "", "pan.txt"); err == nil {
+		t.Error("expected error for unknown extension")
+	}
+}
@@ -0,0 +1 @@
+-- 这两张表可能在迁移之前已手工创建并存有业务数据，回滚时保留，需要时手工删除
@@ -0,0 +1,33 @@
+-- 最初的识别结果表和三方调用记录表，已有手工建的表时跳过
+CREATE TABLE IF NOT EXISTS cu_cust_ocr_result_dtl (
+    id           varchar(40) NOT NULL COMMENT 'ID',
+    INST_TIME    datetime COMMENT '插入时间',
+    UPDT_TIME    datetime COMMENT '修改时间',
+    INST_USER_NO varchar(40) COMMENT '插入用户编码',
+    UPDT_USER_NO varchar(40) COMMENT '修改用户编码',
+    REMARK       varchar(400) COMMENT '备注（修改记录）',
+    CUST_NO      varchar(40) COMMENT '客户唯一编码',
+    BUSI_TYPE    varchar(8) COMMENT '业务类型（码类：1007）',
+    ADV_CODE     varchar(200) COMMENT 'ADV返回code',
+    MESSAGE      varchar(200) COMMENT 'ADV返回message',
+    PAN_NO       varchar(40) COMMENT 'Pan卡编号',
+    CUST_NAME    varchar(500) COMMENT '客户姓名',
+    BIRTHDAY     varchar(40) COMMENT '生日',
+    FATHER_NAME  varchar(500) COMMENT '父亲姓名',
+    PRIMARY KEY (id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS point_third_service_record (
+    REQUEST_TIME     datetime COMMENT '调用时间',
+    RESPONSE_TIME    datetime COMMENT '响应时间',
+    INST_USER_NO     varchar(40) COMMENT '插入用户编码',
+    REMARK           varchar(400) COMMENT '备注（修改记录）',
+    APP_NO           varchar(8) COMMENT 'APP编号',
+    REGIST_NO        varchar(40) COMMENT '客户注册手机号',
+    TRANSACTION_ID   varchar(80) COMMENT '三方响应的transactionId',
+    SERVICE_NAME     varchar(40) COMMENT '三方服务名称',
+    RESPONSE_MESSAGE varchar(400) COMMENT '三方响应的message',
+    RESPONSE_STATUS  varchar(40) COMMENT '三方是否有响应（码类：1000）',
+    RESPONSE_CODE    varchar(40) COMMENT '三方响应的code',
+    IS_PAY           varchar(8) COMMENT '是否收费（码类：1000）'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,5 @@
+-- 台账和调用明细记录已收费的调用，有数据时拒绝回滚
+-- abort-if: SELECT 1 FROM pdl_ocr_attempt LIMIT 1
+-- abort-if: SELECT 1 FROM pdl_ocr_job LIMIT 1
+DROP TABLE IF EXISTS pdl_ocr_attempt;
+DROP TABLE IF EXISTS pdl_ocr_job;
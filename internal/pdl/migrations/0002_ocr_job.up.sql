@@ -0,0 +1,33 @@
+CREATE TABLE pdl_ocr_job (
+    id             varchar(40) NOT NULL COMMENT 'ID',
+    INST_TIME      datetime COMMENT '插入时间',
+    UPDT_TIME      datetime COMMENT '修改时间',
+    CUST_NO        varchar(40) COMMENT '客户唯一编码',
+    BUSI_TYPE      varchar(8) COMMENT '业务类型（码类：1007）',
+    IN_PATH        varchar(400) COMMENT '图片路径',
+    STATUS         varchar(16) COMMENT '任务状态',
+    ATTEMPTS       int COMMENT '尝试次数',
+    LAST_CODE      varchar(200) COMMENT '最后一次ADV返回code',
+    LAST_ERROR     varchar(400) COMMENT '最后一次错误',
+    TRANSACTION_ID varchar(80) COMMENT 'ADV响应的transactionId',
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_job_cust_busi (CUST_NO, BUSI_TYPE),
+    KEY idx_job_status (STATUS)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE pdl_ocr_attempt (
+    id             varchar(40) NOT NULL COMMENT 'ID',
+    INST_TIME      datetime COMMENT '插入时间',
+    CUST_NO        varchar(40) COMMENT '客户唯一编码',
+    BUSI_TYPE      varchar(8) COMMENT '业务类型（码类：1007）',
+    ATTEMPT_NO     int COMMENT '第几次调用',
+    REQUEST_TIME   datetime COMMENT '调用时间',
+    RESPONSE_TIME  datetime COMMENT '响应时间',
+    HTTP_STATUS    int COMMENT 'HTTP状态码',
+    ADV_CODE       varchar(200) COMMENT 'ADV返回code',
+    TRANSACTION_ID varchar(80) COMMENT 'ADV响应的transactionId',
+    IS_PAY         varchar(8) COMMENT '是否收费（码类：1000）',
+    ERROR          varchar(400) COMMENT '错误信息',
+    PRIMARY KEY (id),
+    KEY idx_attempt_cust (CUST_NO)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,5 @@
+ALTER TABLE cu_cust_ocr_result_dtl
+    DROP COLUMN EXTRA_INFO,
+    DROP COLUMN ADDRESS,
+    DROP COLUMN GENDER,
+    DROP COLUMN CARD_TYPE;
@@ -0,0 +1,6 @@
+-- 多证件类型的通用字段
+ALTER TABLE cu_cust_ocr_result_dtl
+    ADD COLUMN CARD_TYPE varchar(40) COMMENT '证件类型',
+    ADD COLUMN GENDER varchar(20) COMMENT '性别',
+    ADD COLUMN ADDRESS varchar(1000) COMMENT '地址',
+    ADD COLUMN EXTRA_INFO varchar(2000) COMMENT '证件其他字段（JSON）';
@@ -0,0 +1,3 @@
+-- 缓存的是已收费的识别结果，有数据时拒绝回滚
+-- abort-if: SELECT 1 FROM pdl_ocr_image_cache LIMIT 1
+DROP TABLE IF EXISTS pdl_ocr_image_cache;
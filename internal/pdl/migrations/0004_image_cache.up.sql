@@ -0,0 +1,17 @@
+CREATE TABLE pdl_ocr_image_cache (
+    id             varchar(120) NOT NULL COMMENT '图片摘要|证件类型',
+    INST_TIME      datetime COMMENT '插入时间',
+    UPDT_TIME      datetime COMMENT '修改时间',
+    IMAGE_HASH     varchar(80) COMMENT '图片内容MD5或S3 ETag',
+    CARD_TYPE      varchar(40) COMMENT '证件类型',
+    CUST_NO        varchar(40) COMMENT '首次识别的客户编码',
+    BUSI_TYPE      varchar(8) COMMENT '业务类型（码类：1007）',
+    PROVIDER       varchar(40) COMMENT 'OCR服务商',
+    ADV_CODE       varchar(200) COMMENT 'ADV返回code',
+    MESSAGE        varchar(200) COMMENT 'ADV返回message',
+    SUCCESS        boolean COMMENT '是否识别成功',
+    TRANSACTION_ID varchar(80) COMMENT 'ADV响应的transactionId',
+    FIELDS         varchar(4000) COMMENT '证件字段（JSON）',
+    HITS           int COMMENT '复用次数',
+    PRIMARY KEY (id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,3 @@
+-- 还有未送达的埋点时拒绝回滚，可先执行 pdl events replay
+-- abort-if: SELECT 1 FROM pdl_event_outbox WHERE STATUS <> 'DELIVERED' LIMIT 1
+DROP TABLE IF EXISTS pdl_event_outbox;
@@ -0,0 +1,15 @@
+CREATE TABLE pdl_event_outbox (
+    id             varchar(40) NOT NULL COMMENT 'ID',
+    INST_TIME      datetime COMMENT '插入时间',
+    UPDT_TIME      datetime COMMENT '修改时间',
+    CUST_NO        varchar(40) COMMENT '客户唯一编码',
+    BUSI_TYPE      varchar(8) COMMENT '业务类型（码类：1007）',
+    TRANSACTION_ID varchar(80) COMMENT '三方响应的transactionId',
+    PAYLOAD        text COMMENT '埋点内容（JSON）',
+    STATUS         varchar(16) COMMENT '发送状态',
+    ATTEMPTS       int COMMENT '发送次数',
+    NEXT_TIME      datetime COMMENT '下次发送时间',
+    LAST_ERROR     varchar(400) COMMENT '最后一次错误',
+    PRIMARY KEY (id),
+    KEY idx_outbox_status (STATUS)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
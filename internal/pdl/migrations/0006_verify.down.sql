@@ -0,0 +1,5 @@
+ALTER TABLE cu_cust_ocr_result_dtl
+    DROP KEY idx_ocr_verify_status,
+    DROP COLUMN VERIFY_MESSAGE,
+    DROP COLUMN VERIFY_STATUS,
+    DROP COLUMN BIRTH_DATE;
@@ -0,0 +1,5 @@
+ALTER TABLE cu_cust_ocr_result_dtl
+    ADD COLUMN BIRTH_DATE date COMMENT '解析后的出生日期',
+    ADD COLUMN VERIFY_STATUS varchar(20) COMMENT '校验状态',
+    ADD COLUMN VERIFY_MESSAGE varchar(400) COMMENT '校验未通过原因',
+    ADD KEY idx_ocr_verify_status (VERIFY_STATUS);
@@ -0,0 +1,9 @@
+-- 已有密文时会截断失败，需先关闭加密并还原数据
+-- abort-if: SELECT 1 FROM cu_cust_ocr_result_dtl WHERE PAN_NO LIKE 'enc:v1:%' OR CUST_NAME LIKE 'enc:v1:%' OR BIRTHDAY LIKE 'enc:v1:%' OR FATHER_NAME LIKE 'enc:v1:%' OR ADDRESS LIKE 'enc:v1:%' OR EXTRA_INFO LIKE 'enc:v1:%' LIMIT 1
+ALTER TABLE cu_cust_ocr_result_dtl
+    MODIFY COLUMN PAN_NO varchar(40) COMMENT 'Pan卡编号',
+    MODIFY COLUMN CUST_NAME varchar(500) COMMENT '客户姓名',
+    MODIFY COLUMN BIRTHDAY varchar(40) COMMENT '生日',
+    MODIFY COLUMN FATHER_NAME varchar(500) COMMENT '父亲姓名',
+    MODIFY COLUMN ADDRESS varchar(1000) COMMENT '地址',
+    MODIFY COLUMN EXTRA_INFO varchar(2000) COMMENT '证件其他字段（JSON）';
@@ -0,0 +1,8 @@
+-- 加密后的密文比明文长
+ALTER TABLE cu_cust_ocr_result_dtl
+    MODIFY COLUMN PAN_NO varchar(200) COMMENT 'Pan卡编号（加密）',
+    MODIFY COLUMN CUST_NAME varchar(500) COMMENT '客户姓名（加密）',
+    MODIFY COLUMN BIRTHDAY varchar(200) COMMENT '生日（加密）',
+    MODIFY COLUMN FATHER_NAME varchar(500) COMMENT '父亲姓名（加密）',
+    MODIFY COLUMN ADDRESS varchar(1000) COMMENT '地址（加密）',
+    MODIFY COLUMN EXTRA_INFO varchar(2000) COMMENT '证件其他字段（JSON，加密）';
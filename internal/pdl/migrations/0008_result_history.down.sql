@@ -0,0 +1,3 @@
+-- 只去掉唯一索引，归档的历史结果保留，需要时手工删除 cu_cust_ocr_result_his
+ALTER TABLE cu_cust_ocr_result_dtl
+    DROP KEY uk_ocr_cust_busi;
@@ -0,0 +1,52 @@
+-- 回滚时保留历史表，重新执行时沿用
+CREATE TABLE IF NOT EXISTS cu_cust_ocr_result_his (
+    id             varchar(40) NOT NULL COMMENT 'ID',
+    RESULT_ID      varchar(40) COMMENT '对应识别结果ID',
+    ARCHIVED_TIME  datetime COMMENT '归档时间',
+    INST_TIME      datetime COMMENT '插入时间',
+    UPDT_TIME      datetime COMMENT '修改时间',
+    INST_USER_NO   varchar(40) COMMENT '插入用户编码',
+    UPDT_USER_NO   varchar(40) COMMENT '修改用户编码',
+    REMARK         varchar(400) COMMENT '备注（修改记录）',
+    CUST_NO        varchar(40) COMMENT '客户唯一编码',
+    BUSI_TYPE      varchar(8) COMMENT '业务类型（码类：1007）',
+    ADV_CODE       varchar(200) COMMENT 'ADV返回code',
+    MESSAGE        varchar(200) COMMENT 'ADV返回message',
+    PAN_NO         varchar(200) COMMENT 'Pan卡编号（加密）',
+    CUST_NAME      varchar(500) COMMENT '客户姓名（加密）',
+    BIRTHDAY       varchar(200) COMMENT '生日（加密）',
+    FATHER_NAME    varchar(500) COMMENT '父亲姓名（加密）',
+    CARD_TYPE      varchar(40) COMMENT '证件类型',
+    GENDER         varchar(20) COMMENT '性别',
+    ADDRESS        varchar(1000) COMMENT '地址（加密）',
+    EXTRA_INFO     varchar(2000) COMMENT '证件其他字段（JSON，加密）',
+    BIRTH_DATE     date COMMENT '解析后的出生日期',
+    VERIFY_STATUS  varchar(20) COMMENT '校验状态',
+    VERIFY_MESSAGE varchar(400) COMMENT '校验未通过原因',
+    PRIMARY KEY (id),
+    KEY idx_ocr_his_cust_busi (CUST_NO, BUSI_TYPE)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- 建唯一索引前归档重复的结果，每组保留 UPDT_TIME 最新的一条
+INSERT INTO cu_cust_ocr_result_his (id, RESULT_ID, ARCHIVED_TIME, INST_TIME, UPDT_TIME, INST_USER_NO, UPDT_USER_NO, REMARK,
+                                    CUST_NO, BUSI_TYPE, ADV_CODE, MESSAGE, PAN_NO, CUST_NAME, BIRTHDAY, FATHER_NAME,
+                                    CARD_TYPE, GENDER, ADDRESS, EXTRA_INFO, BIRTH_DATE, VERIFY_STATUS, VERIFY_MESSAGE)
+SELECT UUID(), d.id, NOW(), d.INST_TIME, d.UPDT_TIME, d.INST_USER_NO, d.UPDT_USER_NO, d.REMARK,
+       d.CUST_NO, d.BUSI_TYPE, d.ADV_CODE, d.MESSAGE, d.PAN_NO, d.CUST_NAME, d.BIRTHDAY, d.FATHER_NAME,
+       d.CARD_TYPE, d.GENDER, d.ADDRESS, d.EXTRA_INFO, d.BIRTH_DATE, d.VERIFY_STATUS, d.VERIFY_MESSAGE
+FROM cu_cust_ocr_result_dtl d
+WHERE EXISTS(SELECT 1
+             FROM cu_cust_ocr_result_dtl n
+             WHERE n.CUST_NO = d.CUST_NO
+               AND n.BUSI_TYPE = d.BUSI_TYPE
+               AND (n.UPDT_TIME > d.UPDT_TIME OR (n.UPDT_TIME = d.UPDT_TIME AND n.id > d.id)));
+
+-- 与归档条件相同，不按历史表关联，历史表中已有的记录指向仍在使用的结果
+DELETE d
+FROM cu_cust_ocr_result_dtl d
+         JOIN cu_cust_ocr_result_dtl n ON n.CUST_NO = d.CUST_NO
+    AND n.BUSI_TYPE = d.BUSI_TYPE
+    AND (n.UPDT_TIME > d.UPDT_TIME OR (n.UPDT_TIME = d.UPDT_TIME AND n.id > d.id));
+
+ALTER TABLE cu_cust_ocr_result_dtl
+    ADD UNIQUE KEY uk_ocr_cust_busi (CUST_NO, BUSI_TYPE);
@@ -0,0 +1,8 @@
+-- 已有超过 8 位的业务类型时会截断失败
+-- abort-if: SELECT 1 FROM pdl_event_outbox WHERE CHAR_LENGTH(BUSI_TYPE) > 8 UNION ALL SELECT 1 FROM pdl_ocr_image_cache WHERE CHAR_LENGTH(BUSI_TYPE) > 8 UNION ALL SELECT 1 FROM pdl_ocr_attempt WHERE CHAR_LENGTH(BUSI_TYPE) > 8 UNION ALL SELECT 1 FROM pdl_ocr_job WHERE CHAR_LENGTH(BUSI_TYPE) > 8 UNION ALL SELECT 1 FROM cu_cust_ocr_result_his WHERE CHAR_LENGTH(BUSI_TYPE) > 8 UNION ALL SELECT 1 FROM cu_cust_ocr_result_dtl WHERE CHAR_LENGTH(BUSI_TYPE) > 8
+ALTER TABLE pdl_event_outbox MODIFY COLUMN BUSI_TYPE varchar(8) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_ocr_image_cache MODIFY COLUMN BUSI_TYPE varchar(8) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_ocr_attempt MODIFY COLUMN BUSI_TYPE varchar(8) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_ocr_job MODIFY COLUMN BUSI_TYPE varchar(8) COMMENT '业务类型（码类：1007）';
+ALTER TABLE cu_cust_ocr_result_his MODIFY COLUMN BUSI_TYPE varchar(8) COMMENT '业务类型（码类：1007）';
+ALTER TABLE cu_cust_ocr_result_dtl MODIFY COLUMN BUSI_TYPE varchar(8) COMMENT '业务类型（码类：1007）';
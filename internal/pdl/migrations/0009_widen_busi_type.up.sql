@@ -0,0 +1,7 @@
+-- busiType 可以直接填写证件类型，如 DRIVING_LICENSE_FRONT
+ALTER TABLE cu_cust_ocr_result_dtl MODIFY COLUMN BUSI_TYPE varchar(40) COMMENT '业务类型（码类：1007）';
+ALTER TABLE cu_cust_ocr_result_his MODIFY COLUMN BUSI_TYPE varchar(40) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_ocr_job MODIFY COLUMN BUSI_TYPE varchar(40) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_ocr_attempt MODIFY COLUMN BUSI_TYPE varchar(40) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_ocr_image_cache MODIFY COLUMN BUSI_TYPE varchar(40) COMMENT '业务类型（码类：1007）';
+ALTER TABLE pdl_event_outbox MODIFY COLUMN BUSI_TYPE varchar(40) COMMENT '业务类型（码类：1007）';
@@ -0,0 +1,4 @@
+-- 已有密文时无法转换为日期，需先关闭加密并还原数据
+-- abort-if: SELECT 1 FROM cu_cust_ocr_result_dtl WHERE BIRTH_DATE LIKE 'enc:v1:%' UNION ALL SELECT 1 FROM cu_cust_ocr_result_his WHERE BIRTH_DATE LIKE 'enc:v1:%'
+ALTER TABLE cu_cust_ocr_result_his MODIFY COLUMN BIRTH_DATE date COMMENT '解析后的出生日期';
+ALTER TABLE cu_cust_ocr_result_dtl MODIFY COLUMN BIRTH_DATE date COMMENT '解析后的出生日期';
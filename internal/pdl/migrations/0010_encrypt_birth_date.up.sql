@@ -0,0 +1,3 @@
+-- 出生日期与其他个人信息字段一起加密，已有的日期转换为 yyyy-MM-dd 文本
+ALTER TABLE cu_cust_ocr_result_dtl MODIFY COLUMN BIRTH_DATE varchar(200) COMMENT '解析后的出生日期（yyyy-MM-dd，加密）';
+ALTER TABLE cu_cust_ocr_result_his MODIFY COLUMN BIRTH_DATE varchar(200) COMMENT '解析后的出生日期（yyyy-MM-dd，加密）';
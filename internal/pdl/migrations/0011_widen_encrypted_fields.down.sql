@@ -0,0 +1,8 @@
+-- 已有超长的地址或证件其他字段时会截断失败
+-- abort-if: SELECT 1 FROM cu_cust_ocr_result_dtl WHERE CHAR_LENGTH(ADDRESS) > 1000 OR CHAR_LENGTH(EXTRA_INFO) > 2000 UNION ALL SELECT 1 FROM cu_cust_ocr_result_his WHERE CHAR_LENGTH(ADDRESS) > 1000 OR CHAR_LENGTH(EXTRA_INFO) > 2000
+ALTER TABLE cu_cust_ocr_result_his
+    MODIFY COLUMN ADDRESS varchar(1000) COMMENT '地址（加密）',
+    MODIFY COLUMN EXTRA_INFO varchar(2000) COMMENT '证件其他字段（JSON，加密）';
+ALTER TABLE cu_cust_ocr_result_dtl
+    MODIFY COLUMN ADDRESS varchar(1000) COMMENT '地址（加密）',
+    MODIFY COLUMN EXTRA_INFO varchar(2000) COMMENT '证件其他字段（JSON，加密）';
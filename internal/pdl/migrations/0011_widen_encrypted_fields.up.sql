@@ -0,0 +1,7 @@
+-- 加密后长度约为原文的 4/3 再加 40 字节，地址和证件其他字段改为 text
+ALTER TABLE cu_cust_ocr_result_dtl
+    MODIFY COLUMN ADDRESS text COMMENT '地址（加密）',
+    MODIFY COLUMN EXTRA_INFO text COMMENT '证件其他字段（JSON，加密）';
+ALTER TABLE cu_cust_ocr_result_his
+    MODIFY COLUMN ADDRESS text COMMENT '地址（加密）',
+    MODIFY COLUMN EXTRA_INFO text COMMENT '证件其他字段（JSON，加密）';
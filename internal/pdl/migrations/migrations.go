@@ -0,0 +1,20 @@
+// Package migrations 为 pdl 使用的 MySQL 表结构迁移，由 pdl migrate 执行
+//
+// 新增迁移时在本目录添加 NNNN_name.up.sql 和 NNNN_name.down.sql，
+// 版本号递增，已发布的文件不再修改，同时保持 loan 包中模型的 gorm 标签一致
+// 回滚不删除已有业务数据，可能截断或无法转换数据时用 -- abort-if: 检查后拒绝执行
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+
+	"github.com/onlythinking/pug-go/pkg/migrate"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, FS)
+}
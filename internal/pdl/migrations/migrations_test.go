@@ -0,0 +1,51 @@
+package migrations_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/onlythinking/pug-go/internal/pdl/migrations"
+	"github.com/onlythinking/pug-go/pkg/migrate"
+)
+
+func TestMigrations(t *testing.T) {
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("expected migrations")
+	}
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Errorf("expected version %d, got %d_%s", i+1, m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestDownKeepsData(t *testing.T) {
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 识别结果、历史和三方调用记录为业务数据，回滚时保留
+	kept := []string{"cu_cust_ocr_result_dtl", "cu_cust_ocr_result_his", "point_third_service_record"}
+	// 台账、缓存和发件箱有数据时拒绝回滚
+	guarded := map[string]bool{"ocr_job": true, "image_cache": true, "event_outbox": true,
+		"encrypt_pii": true, "widen_busi_type": true, "encrypt_birth_date": true, "widen_encrypted_fields": true}
+	for _, m := range all {
+		for _, stmt := range migrate.Statements(m.Down) {
+			for _, table := range kept {
+				if strings.Contains(stmt, "DROP TABLE") && strings.Contains(stmt, table) {
+					t.Errorf("migration %d_%s drops %s on down", m.Version, m.Name, table)
+				}
+			}
+		}
+		if guarded[m.Name] && len(migrate.AbortIfs(m.Down)) == 0 {
+			t.Errorf("migration %d_%s has no abort-if check on down", m.Version, m.Name)
+		}
+	}
+}
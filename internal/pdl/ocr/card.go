@@ -0,0 +1,29 @@
+package ocr
+
+import "strings"
+
+// 证件类型
+const (
+	PanFront            = "PAN_FRONT"
+	AadhaarFront        = "AADHAAR_FRONT"
+	AadhaarBack         = "AADHAAR_BACK"
+	VoterFront          = "VOTER_FRONT"
+	VoterBack           = "VOTER_BACK"
+	DrivingLicenceFront = "DRIVING_LICENSE_FRONT"
+	PassportFront       = "PASSPORT_FRONT"
+)
+
+var cardTypes = map[string]bool{
+	PanFront:            true,
+	AadhaarFront:        true,
+	AadhaarBack:         true,
+	VoterFront:          true,
+	VoterBack:           true,
+	DrivingLicenceFront: true,
+	PassportFront:       true,
+}
+
+// 是否为支持的证件类型
+func IsCardType(cardType string) bool {
+	return cardTypes[strings.ToUpper(cardType)]
+}
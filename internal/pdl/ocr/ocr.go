@@ -0,0 +1,67 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// OCR 额度耗尽（余额不足、达到上限），整个批次应停止
+var ErrQuotaExhausted = errors.New("ocr: quota exhausted")
+
+func IsQuotaExhausted(err error) bool {
+	return errors.Is(err, ErrQuotaExhausted)
+}
+
+// OCR 服务商
+type Provider interface {
+	// 服务商名称
+	Name() string
+	// 识别证件图片，cardType 见证件类型常量。出错时 Result 可能不为空，其中保留已发出的调用记录
+	Recognize(ctx context.Context, filename string, cardType string) (*Result, error)
+}
+
+// 支持直接识别内存中图片的服务商，图片无需落盘
+type ImageRecognizer interface {
+	// name 为图片文件名，用于上传和日志
+	RecognizeImage(ctx context.Context, name string, image []byte, cardType string) (*Result, error)
+}
+
+// 与服务商无关的识别结果
+type Result struct {
+	Provider      string
+	Code          string
+	Message       string
+	Success       bool
+	Terminal      bool // 永久失败，不应再重试
+	Exhausted     bool // 额度耗尽
+	Paid          bool
+	TransactionId string
+	CardType      string
+	Fields        CardFields
+	Raw           []byte
+	Attempts      []Attempt
+}
+
+// 归一化后的证件字段，各证件特有的字段放在 Extra 中
+type CardFields struct {
+	IdNumber   string
+	Name       string
+	Birthday   string
+	FatherName string
+	Gender     string
+	Address    string
+	Extra      map[string]string
+}
+
+// 单次调用记录
+type Attempt struct {
+	No            int
+	RequestTime   time.Time
+	ResponseTime  time.Time
+	HttpStatus    int
+	Code          string
+	TransactionId string
+	Paid          bool
+	Err           string
+}
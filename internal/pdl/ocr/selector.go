@@ -0,0 +1,91 @@
+package ocr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onlythinking/pug-go/internal/config"
+)
+
+// 按业务类型选择服务商和证件类型
+type Selector struct {
+	defaultProvider Provider
+	byBusiType      map[string]Provider
+	defaultCardType string
+	cardTypes       map[string]string
+}
+
+func NewSelector(defaultProvider Provider) *Selector {
+	return &Selector{
+		defaultProvider: defaultProvider,
+		byBusiType:      map[string]Provider{},
+		defaultCardType: PanFront,
+		cardTypes:       map[string]string{},
+	}
+}
+
+// 根据配置创建，未配置默认服务商时使用第一个服务商
+func NewSelectorFromConfig(providers []Provider, cfg config.OcrConfig) (*Selector, error) {
+	defaultName := cfg.DefaultProvider
+	named := make(map[string]Provider, len(providers))
+	for _, p := range providers {
+		named[p.Name()] = p
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no ocr provider")
+	}
+	def := providers[0]
+	if defaultName != "" {
+		p, ok := named[defaultName]
+		if !ok {
+			return nil, fmt.Errorf("unknown ocr provider %s", defaultName)
+		}
+		def = p
+	}
+
+	selector := NewSelector(def)
+	for busiType, name := range cfg.Providers {
+		p, ok := named[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown ocr provider %s for busiType %s", name, busiType)
+		}
+		selector.Register(busiType, p)
+	}
+
+	if cfg.DefaultCardType != "" {
+		if !IsCardType(cfg.DefaultCardType) {
+			return nil, fmt.Errorf("unknown card type %s", cfg.DefaultCardType)
+		}
+		selector.defaultCardType = strings.ToUpper(cfg.DefaultCardType)
+	}
+	for busiType, cardType := range cfg.CardTypes {
+		if !IsCardType(cardType) {
+			return nil, fmt.Errorf("unknown card type %s for busiType %s", cardType, busiType)
+		}
+		selector.cardTypes[busiType] = strings.ToUpper(cardType)
+	}
+	return selector, nil
+}
+
+func (ths *Selector) Register(busiType string, provider Provider) {
+	ths.byBusiType[busiType] = provider
+}
+
+// 业务类型对应的证件类型，busiType 本身是证件类型时直接使用
+func (ths *Selector) CardType(busiType string) string {
+	if IsCardType(busiType) {
+		return strings.ToUpper(busiType)
+	}
+	if cardType, ok := ths.cardTypes[busiType]; ok {
+		return cardType
+	}
+	return ths.defaultCardType
+}
+
+func (ths *Selector) For(busiType string) Provider {
+	if p, ok := ths.byBusiType[busiType]; ok {
+		return p
+	}
+	return ths.defaultProvider
+}
@@ -0,0 +1,107 @@
+package verify
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 转为大写，只保留字母，撇号直接去掉，其余字符视为分隔，合并连续空白
+// cleaned 为 true 表示去掉了数字或其他符号
+func NormalizeName(raw string) (name string, cleaned bool) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(raw) {
+		switch {
+		case unicode.IsLetter(r):
+			b.WriteRune(r)
+		case r == '\'' || r == '’':
+		case unicode.IsSpace(r) || r == '.' || r == ',' || r == '-':
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(' ')
+			cleaned = true
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " "), cleaned
+}
+
+// 两个姓名的相似度 0~1，与顺序无关
+// 逐词匹配，缩写与首字母相同的词按 0.8 计，其余按编辑距离计，按 Dice 系数汇总
+func NameSimilarity(a string, b string) float64 {
+	x, _ := NormalizeName(a)
+	y, _ := NormalizeName(b)
+	xs, ys := strings.Fields(x), strings.Fields(y)
+	if len(xs) == 0 || len(ys) == 0 {
+		return 0
+	}
+
+	used := make([]bool, len(ys))
+	var matched float64
+	for _, word := range xs {
+		best, bestIndex := 0.0, -1
+		for i, other := range ys {
+			if used[i] {
+				continue
+			}
+			if score := wordSimilarity(word, other); score > best {
+				best, bestIndex = score, i
+			}
+		}
+		if bestIndex >= 0 {
+			used[bestIndex] = true
+			matched += best
+		}
+	}
+	return 2 * matched / float64(len(xs)+len(ys))
+}
+
+// 低于此相似度的词视为不匹配
+const minWordSimilarity = 0.6
+
+func wordSimilarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if (len(ra) == 1 || len(rb) == 1) && ra[0] == rb[0] {
+		return 0.8
+	}
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	score := 1 - float64(levenshtein(ra, rb))/float64(longest)
+	if score < minWordSimilarity {
+		return 0
+	}
+	return score
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
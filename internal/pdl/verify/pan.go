@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 5 位字母、4 位数字、1 位字母，第 4 位为持有人类型
+var panPattern = regexp.MustCompile(`^[A-Z]{3}[ABCFGHJLPT][A-Z][0-9]{4}[A-Z]$`)
+
+// PAN 第 4 位持有人类型
+const (
+	HolderIndividual = 'P'
+	HolderCompany    = 'C'
+)
+
+// 字母位和数字位上 OCR 常见的误识别
+var (
+	letterFixes = map[byte]byte{'0': 'O', '1': 'I', '2': 'Z', '5': 'S', '6': 'G', '8': 'B'}
+	digitFixes  = map[byte]byte{'O': '0', 'D': '0', 'Q': '0', 'I': '1', 'L': '1', 'Z': '2', 'S': '5', 'G': '6', 'B': '8'}
+)
+
+// 是否为合法的 PAN 格式
+func ValidPan(pan string) bool {
+	return panPattern.MatchString(pan)
+}
+
+// 去掉空白和分隔符并转为大写，不改动字符
+func CleanPan(raw string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "", ".", "", "\t", "").Replace(raw))
+}
+
+// 在 CleanPan 的基础上，长度为 10 时按位置纠正字母和数字的误识别
+// corrected 为 true 表示做过纠正，纠正结果只能作为建议
+func NormalizePan(raw string) (pan string, corrected bool) {
+	pan = CleanPan(raw)
+	if len(pan) != 10 {
+		return pan, false
+	}
+	b := []byte(pan)
+	for i, c := range b {
+		fixes := letterFixes
+		if i >= 5 && i <= 8 {
+			fixes = digitFixes
+		}
+		if fixed, ok := fixes[c]; ok {
+			b[i] = fixed
+			corrected = true
+		}
+	}
+	return string(b), corrected
+}
+
+// 持有人类型，格式不合法时返回 0
+func HolderType(pan string) byte {
+	if !ValidPan(pan) {
+		return 0
+	}
+	return pan[3]
+}
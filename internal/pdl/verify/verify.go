@@ -0,0 +1,150 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+)
+
+// 校验状态，按严重程度从低到高
+const (
+	StatusValid         = "VALID"          // 通过
+	StatusLowConfidence = "LOW_CONFIDENCE" // 字段缺失、做过纠正或无法解析，需人工复核
+	StatusNameMismatch  = "NAME_MISMATCH"  // 识别姓名与已有客户姓名不符
+	StatusInvalid       = "INVALID"        // 证件号格式不合法
+)
+
+var severity = map[string]int{StatusValid: 0, StatusLowConfidence: 1, StatusNameMismatch: 2, StatusInvalid: 3}
+
+// 出生日期支持的格式，印度证件通常为日/月/年
+var birthdayLayouts = []string{"02/01/2006", "02-01-2006", "02.01.2006", "2006-01-02", "2006/01/02", "2/1/2006"}
+
+// 最早出生年份
+const minBirthYear = 1900
+
+// 校验结果，Fields 为归一化后的字段，出生日期保留原文，解析结果见 BirthDate
+// 证件号只去掉空白和分隔符，纠正误识别后的 PAN 见 SuggestedPan
+// Reasons 不含字段值，可直接落库和打印
+type Result struct {
+	Fields       ocr.CardFields
+	SuggestedPan string
+	BirthDate    *time.Time
+	NameScore    float64 // 与已有客户姓名的相似度，未比对时为 0
+	Status       string
+	Reasons      []string
+}
+
+func (ths *Result) flag(status string, format string, args ...interface{}) {
+	if severity[status] > severity[ths.Status] {
+		ths.Status = status
+	}
+	ths.Reasons = append(ths.Reasons, fmt.Sprintf(format, args...))
+}
+
+// 原因汇总，用于落库
+func (ths *Result) Message() string {
+	return strings.Join(ths.Reasons, "; ")
+}
+
+// 识别结果校验：证件号格式、姓名和出生日期归一化、与已有客户姓名比对
+type Verifier struct {
+	NameThreshold float64
+}
+
+// 未配置的项使用默认值
+func NewVerifier(cfg config.VerifyConfig) *Verifier {
+	ths := &Verifier{NameThreshold: cfg.NameThreshold}
+	if ths.NameThreshold <= 0 || ths.NameThreshold > 1 {
+		ths.NameThreshold = 0.75
+	}
+	return ths
+}
+
+// holderName 为已有的客户姓名，为空时不比对
+func (ths *Verifier) Verify(cardType string, fields ocr.CardFields, holderName string) Result {
+	result := Result{Fields: fields, Status: StatusValid}
+	pan := strings.EqualFold(cardType, ocr.PanFront)
+
+	if pan {
+		ths.verifyPan(&result)
+	}
+
+	name, cleaned := NormalizeName(fields.Name)
+	result.Fields.Name = name
+	if cleaned {
+		result.flag(StatusLowConfidence, "name contains non-letters")
+	}
+	if pan && name == "" {
+		result.flag(StatusLowConfidence, "name is empty")
+	}
+	result.Fields.FatherName, _ = NormalizeName(fields.FatherName)
+
+	// 公司等非个人 PAN 没有出生日期
+	panNo := result.Fields.IdNumber
+	if result.SuggestedPan != "" {
+		panNo = result.SuggestedPan
+	}
+	ths.verifyBirthday(&result, pan && HolderType(panNo) == HolderIndividual)
+
+	if holderName != "" && name != "" {
+		result.NameScore = NameSimilarity(name, holderName)
+		if result.NameScore < ths.NameThreshold {
+			result.flag(StatusNameMismatch, "name does not match holder name (%.2f)", result.NameScore)
+		}
+	}
+	return result
+}
+
+func (ths *Verifier) verifyPan(result *Result) {
+	raw := result.Fields.IdNumber
+	pan, corrected := NormalizePan(raw)
+	if pan == "" {
+		result.flag(StatusInvalid, "PAN is empty")
+		return
+	}
+	if !ValidPan(pan) {
+		result.flag(StatusInvalid, "invalid PAN format")
+		return
+	}
+	// 纠正可能出错，证件号保留识别出的值，由人工复核是否采用建议
+	result.Fields.IdNumber = CleanPan(raw)
+	if corrected {
+		result.SuggestedPan = pan
+		result.flag(StatusLowConfidence, "PAN needs correction")
+	}
+}
+
+// required 为 true 时出生日期为空也需复核
+func (ths *Verifier) verifyBirthday(result *Result, required bool) {
+	raw := strings.TrimSpace(result.Fields.Birthday)
+	if raw == "" {
+		if required {
+			result.flag(StatusLowConfidence, "birthday is empty")
+		}
+		return
+	}
+	birthDate, err := ParseBirthday(raw)
+	if err != nil {
+		result.flag(StatusLowConfidence, "unparseable birthday")
+		return
+	}
+	if birthDate.Year() < minBirthYear || birthDate.After(time.Now()) {
+		result.flag(StatusLowConfidence, "birthday out of range")
+		return
+	}
+	result.BirthDate = &birthDate
+}
+
+// 按支持的格式解析出生日期
+func ParseBirthday(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range birthdayLayouts {
+		if t, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unparseable birthday %q", raw)
+}
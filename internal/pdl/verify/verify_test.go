@@ -0,0 +1,90 @@
+package verify_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/internal/pdl/ocr"
+	"github.com/onlythinking/pug-go/internal/pdl/verify"
+)
+
+func TestNormalizePan(t *testing.T) {
+	for raw, want := range map[string]struct {
+		pan       string
+		corrected bool
+		valid     bool
+	}{
+		"ABCPK1234F":  {"ABCPK1234F", false, true},
+		"abcpk 1234f": {"ABCPK1234F", false, true},
+		"A8CPKI23OF":  {"ABCPK1230F", true, true},
+		"ABCDE1234F":  {"ABCDE1234F", false, false},
+		"ABCPK123F":   {"ABCPK123F", false, false},
+	} {
+		pan, corrected := verify.NormalizePan(raw)
+		if pan != want.pan || corrected != want.corrected || verify.ValidPan(pan) != want.valid {
+			t.Errorf("%s: got %s %v %v", raw, pan, corrected, verify.ValidPan(pan))
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	for _, c := range []struct {
+		a, b  string
+		match bool
+	}{
+		{"RAVI KUMAR", "Kumar Ravi", true},
+		{"R. KUMAR", "RAVI KUMAR", true},
+		{"RAVI KUMAR SHARMA", "RAVI SHARMA", true},
+		{"RAVl KUMAR", "RAVI KUMAR", true},
+		{"RAVI", "RAVI KUMAR", false},
+		{"SUNIL SHARMA", "RAVI KUMAR", false},
+	} {
+		score := verify.NameSimilarity(c.a, c.b)
+		if (score >= 0.75) != c.match {
+			t.Errorf("%q %q: unexpected score %.2f", c.a, c.b, score)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	verifier := verify.NewVerifier(config.VerifyConfig{})
+	for name, c := range map[string]struct {
+		cardType string
+		fields   ocr.CardFields
+		holder   string
+		status   string
+	}{
+		"valid":      {ocr.PanFront, ocr.CardFields{IdNumber: "ABCPK1234F", Name: "RAVI KUMAR", Birthday: "15/08/1990"}, "ravi kumar", verify.StatusValid},
+		"company":    {ocr.PanFront, ocr.CardFields{IdNumber: "ABCCK1234F", Name: "ACME LIMITED"}, "", verify.StatusValid},
+		"corrected":  {ocr.PanFront, ocr.CardFields{IdNumber: "ABCPK12S4F", Name: "RAVI KUMAR", Birthday: "15/08/1990"}, "", verify.StatusLowConfidence},
+		"noBirthday": {ocr.PanFront, ocr.CardFields{IdNumber: "ABCPK1234F", Name: "RAVI KUMAR"}, "", verify.StatusLowConfidence},
+		"future":     {ocr.PanFront, ocr.CardFields{IdNumber: "ABCPK1234F", Name: "RAVI KUMAR", Birthday: "15/08/2990"}, "", verify.StatusLowConfidence},
+		"digits":     {ocr.PanFront, ocr.CardFields{IdNumber: "ABCPK1234F", Name: "RAV1 KUMAR", Birthday: "15/08/1990"}, "", verify.StatusLowConfidence},
+		"mismatch":   {ocr.PanFront, ocr.CardFields{IdNumber: "ABCPK1234F", Name: "RAVI KUMAR", Birthday: "15/08/1990"}, "SUNIL SHARMA", verify.StatusNameMismatch},
+		"invalid":    {ocr.PanFront, ocr.CardFields{IdNumber: "ABC1234", Name: "RAVI KUMAR"}, "SUNIL SHARMA", verify.StatusInvalid},
+		"otherCard":  {ocr.AadhaarBack, ocr.CardFields{IdNumber: "1234 5678 9012", Address: "MUMBAI"}, "RAVI KUMAR", verify.StatusValid},
+	} {
+		result := verifier.Verify(c.cardType, c.fields, c.holder)
+		if result.Status != c.status {
+			t.Errorf("%s: expected %s, got %s (%s)", name, c.status, result.Status, result.Message())
+		}
+	}
+}
+
+func TestVerifyKeepsRawPan(t *testing.T) {
+	verifier := verify.NewVerifier(config.VerifyConfig{})
+	result := verifier.Verify(ocr.PanFront, ocr.CardFields{IdNumber: "abcpk 12s4f", Name: "RAVI KUMAR"}, "")
+	if result.Fields.IdNumber != "ABCPK12S4F" || result.SuggestedPan != "ABCPK1254F" {
+		t.Errorf("unexpected pan %s, suggested %s", result.Fields.IdNumber, result.SuggestedPan)
+	}
+	// 按建议的 PAN 判断为个人，缺少出生日期
+	if result.Status != verify.StatusLowConfidence || !strings.Contains(result.Message(), "birthday is empty") {
+		t.Errorf("unexpected result %s %s", result.Status, result.Message())
+	}
+
+	result = verifier.Verify(ocr.PanFront, ocr.CardFields{IdNumber: "abcpk 1234f", Name: "RAVI KUMAR", Birthday: "15/08/1990"}, "")
+	if result.Fields.IdNumber != "ABCPK1234F" || result.SuggestedPan != "" || result.Status != verify.StatusValid {
+		t.Errorf("unexpected result %#v", result)
+	}
+}
@@ -0,0 +1,247 @@
+package excel
+
+import (
+	"archive/zip"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 内置数字格式，见 ECMA-376 18.8.30
+var builtinNumFmts = map[int]string{
+	0: "General", 1: "0", 2: "0.00", 3: "#,##0", 4: "#,##0.00",
+	9: "0%", 10: "0.00%", 11: "0.00E+00", 12: "# ?/?", 13: "# ??/??",
+	14: "mm-dd-yy", 15: "d-mmm-yy", 16: "d-mmm", 17: "mmm-yy",
+	18: "h:mm AM/PM", 19: "h:mm:ss AM/PM", 20: "h:mm", 21: "h:mm:ss", 22: "m/d/yy h:mm",
+	37: "#,##0 ;(#,##0)", 38: "#,##0 ;[Red](#,##0)", 39: "#,##0.00;(#,##0.00)", 40: "#,##0.00;[Red](#,##0.00)",
+	45: "mm:ss", 46: "[h]:mm:ss", 47: "mmss.0", 48: "##0.0E+0", 49: "@",
+}
+
+// 数字单元格的显示格式，只支持常用部分：
+// 整数位补零（00000）、小数位（0.00、0.##）、千分位（#,##0）、百分比和日期时间，
+// 日期输出为 2006-01-02 15:04:05 格式，其余格式（科学计数、分数、文字前后缀等）按常规格式输出，
+// 常规格式最多保留 15 位有效数字，不使用科学计数法
+type numFormat struct {
+	text        bool // @，原样输出
+	date        bool
+	time        bool
+	percent     bool
+	group       bool
+	intDigits   int // 整数最少位数
+	minDecimals int
+	maxDecimals int
+	general     bool
+}
+
+var generalFormat = numFormat{general: true}
+
+func parseNumFormat(code string) numFormat {
+	// 只使用正数部分
+	if i := strings.IndexByte(code, ';'); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" || strings.EqualFold(code, "General") {
+		return generalFormat
+	}
+
+	var f numFormat
+	var digits strings.Builder
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch c {
+		case '"':
+			// 引号中的文字
+			if j := strings.IndexByte(code[i+1:], '"'); j >= 0 {
+				i += j + 1
+			}
+		case '\\', '_', '*':
+			i++
+		case '[':
+			// 颜色、区域等设置，[h] [mm] [ss] 为累计时间
+			if j := strings.IndexByte(code[i:], ']'); j >= 0 {
+				section := strings.ToLower(code[i+1 : i+j])
+				if strings.Trim(section, "hms") == "" {
+					f.time = true
+				}
+				i += j
+			}
+		case '@':
+			f.text = true
+		case '%':
+			f.percent = true
+		case 'y', 'Y', 'd', 'D':
+			f.date = true
+		case 'm', 'M':
+			// m 在 h 之后或 s 之前为分钟，单独出现时按月处理
+			f.date = true
+		case 'h', 'H', 's', 'S':
+			f.time = true
+		case 'e', 'E':
+			// 科学计数法按常规格式输出
+			if !f.date {
+				return generalFormat
+			}
+		case '0', '#', '?', ',', '.':
+			digits.WriteByte(c)
+		}
+	}
+	if f.text {
+		return f
+	}
+	if f.date || f.time {
+		// 只有时和分时 m 表示分钟
+		if f.time && !strings.ContainsAny(strings.ToLower(code), "yd") {
+			f.date = false
+		}
+		return f
+	}
+	if digits.Len() == 0 {
+		return generalFormat
+	}
+
+	pattern := digits.String()
+	intPart, decPart := pattern, ""
+	if i := strings.IndexByte(pattern, '.'); i >= 0 {
+		intPart, decPart = pattern[:i], pattern[i+1:]
+	}
+	f.group = strings.Contains(strings.Trim(intPart, ","), ",")
+	f.intDigits = strings.Count(intPart, "0")
+	f.minDecimals = strings.Count(decPart, "0")
+	f.maxDecimals = len(strings.Trim(decPart, ","))
+	return f
+}
+
+// 按格式输出数字单元格的值，无法解析时原样返回
+func (ths numFormat) format(value string, date1904 bool) string {
+	if ths.text {
+		return value
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return value
+	}
+	if ths.date || ths.time {
+		return formatDate(v, date1904, ths.date, ths.time)
+	}
+	if ths.general {
+		return formatGeneral(v)
+	}
+
+	if ths.percent {
+		v *= 100
+	}
+	s := strconv.FormatFloat(v, 'f', ths.maxDecimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, decPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, decPart = s[:i], s[i+1:]
+	}
+	// 可选小数位去掉末尾的 0
+	for len(decPart) > ths.minDecimals && strings.HasSuffix(decPart, "0") {
+		decPart = decPart[:len(decPart)-1]
+	}
+	if intPart == "0" && ths.intDigits == 0 {
+		intPart = ""
+	}
+	for len(intPart) < ths.intDigits {
+		intPart = "0" + intPart
+	}
+	if ths.group {
+		intPart = groupThousands(intPart)
+	}
+	if strings.Trim(intPart+decPart, "0,") == "" {
+		sign = ""
+	}
+
+	s = sign + intPart
+	if decPart != "" {
+		s += "." + decPart
+	}
+	if s == "" {
+		s = "0"
+	}
+	if ths.percent {
+		s += "%"
+	}
+	return s
+}
+
+// 常规格式，如 9.87654321E9 输出为 9876543210
+func formatGeneral(v float64) string {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 15, 64), 64)
+	if err != nil {
+		rounded = v
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+func groupThousands(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// Excel 日期序列号转换为日期，1900 日期系统从 1899-12-30 起算（已包含 1900-02-29 的偏差）
+func formatDate(v float64, date1904 bool, date bool, clock bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(v)
+	seconds := math.Round((v - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	switch {
+	case date && clock:
+		return t.Format("2006-01-02 15:04:05")
+	case clock:
+		return t.Format("15:04:05")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// 读取样式表中每个单元格样式的数字格式，下标为单元格的 s 属性
+func readNumFormats(f *zip.File) ([]numFormat, error) {
+	var styles struct {
+		NumFmts []struct {
+			Id   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtId int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodeFile(f, &styles); err != nil {
+		return nil, err
+	}
+
+	codes := make(map[int]string, len(builtinNumFmts)+len(styles.NumFmts))
+	for id, code := range builtinNumFmts {
+		codes[id] = code
+	}
+	for _, numFmt := range styles.NumFmts {
+		codes[numFmt.Id] = numFmt.Code
+	}
+
+	formats := make([]numFormat, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		formats[i] = parseNumFormat(codes[xf.NumFmtId])
+	}
+	return formats, nil
+}
@@ -0,0 +1,368 @@
+package excel
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 流式读取 xlsx 第一个 sheet
+// 逐行解析 sheet XML，内存占用与行数无关（共享字符串表需整体加载）
+type RowReader struct {
+	zr            *zip.ReadCloser
+	sheet         io.ReadCloser
+	decoder       *xml.Decoder
+	sharedStrings []string
+	numFormats    []numFormat
+	date1904      bool
+	row           int
+}
+
+func Open(filename string) (*RowReader, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader := &RowReader{zr: zr}
+	if err := reader.open(); err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return reader, nil
+}
+
+func (ths *RowReader) open() error {
+	files := make(map[string]*zip.File, len(ths.zr.File))
+	for _, f := range ths.zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		sharedStrings, err := readSharedStrings(f)
+		if err != nil {
+			return err
+		}
+		ths.sharedStrings = sharedStrings
+	}
+
+	if f, ok := files["xl/styles.xml"]; ok {
+		numFormats, err := readNumFormats(f)
+		if err != nil {
+			return err
+		}
+		ths.numFormats = numFormats
+	}
+	date1904, err := isDate1904(files)
+	if err != nil {
+		return err
+	}
+	ths.date1904 = date1904
+
+	name, err := firstSheet(files)
+	if err != nil {
+		return err
+	}
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("sheet %s not found", name)
+	}
+	sheet, err := f.Open()
+	if err != nil {
+		return err
+	}
+	ths.sheet = sheet
+	ths.decoder = xml.NewDecoder(sheet)
+	return nil
+}
+
+// 读取下一行，返回行号（从 1 开始）和各列的值，结束时返回 io.EOF
+// 空行不会返回，行号可能不连续
+func (ths *RowReader) Next() (int, []string, error) {
+	for {
+		token, err := ths.decoder.Token()
+		if err != nil {
+			return 0, nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		ths.row++
+		if r := attr(start, "r"); r != "" {
+			if n, err := strconv.Atoi(r); err == nil {
+				ths.row = n
+			}
+		}
+		cells, err := ths.readRow()
+		if err != nil {
+			return 0, nil, fmt.Errorf("row %d: %w", ths.row, err)
+		}
+		return ths.row, cells, nil
+	}
+}
+
+func (ths *RowReader) readRow() ([]string, error) {
+	var cells []string
+	col := -1
+	for {
+		token, err := ths.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			col++
+			if ref := attr(t, "r"); ref != "" {
+				if n, ok := columnIndex(ref); ok {
+					col = n
+				}
+			}
+			value, err := ths.readCell(t)
+			if err != nil {
+				return nil, err
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = value
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return cells, nil
+			}
+		}
+	}
+}
+
+func (ths *RowReader) readCell(start xml.StartElement) (string, error) {
+	var value, inline strings.Builder
+	var inValue, inText bool
+	for {
+		token, err := ths.decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "v":
+				inValue = true
+			case "t":
+				inText = true
+			case "rPh":
+				// 注音不属于单元格内容
+				if err := ths.decoder.Skip(); err != nil {
+					return "", err
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			} else if inText {
+				inline.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v":
+				inValue = false
+			case "t":
+				inText = false
+			case "c":
+				return ths.cellValue(attr(start, "t"), attr(start, "s"), value.String(), inline.String())
+			}
+		}
+	}
+}
+
+// 数字单元格按样式中的数字格式输出，如 00123 不会变成 123，见 numFormat
+func (ths *RowReader) cellValue(cellType string, style string, value string, inline string) (string, error) {
+	switch cellType {
+	case "s":
+		if strings.TrimSpace(value) == "" {
+			return "", nil
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || i < 0 || i >= len(ths.sharedStrings) {
+			return "", fmt.Errorf("invalid shared string index %q", value)
+		}
+		return ths.sharedStrings[i], nil
+	case "inlineStr":
+		return inline, nil
+	case "b":
+		if value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "", "n":
+		if value == "" {
+			return "", nil
+		}
+		return ths.numFormat(style).format(value, ths.date1904), nil
+	}
+	return value, nil
+}
+
+func (ths *RowReader) numFormat(style string) numFormat {
+	i, err := strconv.Atoi(style)
+	if err != nil || i < 0 || i >= len(ths.numFormats) {
+		return generalFormat
+	}
+	return ths.numFormats[i]
+}
+
+func (ths *RowReader) Close() error {
+	if ths.sheet != nil {
+		ths.sheet.Close()
+	}
+	return ths.zr.Close()
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// 单元格引用（如 AB12）的列序号，从 0 开始
+func columnIndex(ref string) (int, bool) {
+	n := 0
+	i := 0
+	for ; i < len(ref); i++ {
+		c := ref[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A'+1)
+	}
+	if i == 0 {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// 按 workbook 中的顺序找到第一个 sheet 的路径
+func firstSheet(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	workbook, ok := files["xl/workbook.xml"]
+	if !ok {
+		return fallback, nil
+	}
+	var wb struct {
+		Sheets []struct {
+			Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeFile(workbook, &wb); err != nil {
+		return "", err
+	}
+	rels, ok := files["xl/_rels/workbook.xml.rels"]
+	if len(wb.Sheets) == 0 || !ok {
+		return fallback, nil
+	}
+	var relationships struct {
+		Items []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeFile(rels, &relationships); err != nil {
+		return "", err
+	}
+	for _, rel := range relationships.Items {
+		if rel.Id != wb.Sheets[0].Id {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// 是否使用 1904 日期系统
+func isDate1904(files map[string]*zip.File) (bool, error) {
+	workbook, ok := files["xl/workbook.xml"]
+	if !ok {
+		return false, nil
+	}
+	var wb struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+	}
+	if err := decodeFile(workbook, &wb); err != nil {
+		return false, err
+	}
+	return wb.Pr.Date1904 == "1" || wb.Pr.Date1904 == "true", nil
+}
+
+func decodeFile(f *zip.File, v interface{}) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// 流式读取共享字符串表
+func readSharedStrings(f *zip.File) ([]string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var sharedStrings []string
+	var text strings.Builder
+	var inText bool
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return sharedStrings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				text.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "si":
+				sharedStrings = append(sharedStrings, text.String())
+			}
+		}
+	}
+}
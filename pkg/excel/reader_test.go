@@ -0,0 +1,172 @@
+package excel_test
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/onlythinking/pug-go/pkg/excel"
+	"github.com/tealeg/xlsx/v3"
+)
+
+type row struct {
+	No    int
+	Cells []string
+}
+
+func readAll(t *testing.T, filename string) []row {
+	t.Helper()
+	reader, err := excel.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var rows []row
+	for {
+		no, cells, err := reader.Next()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row{no, cells})
+	}
+}
+
+func TestReadXlsx(t *testing.T) {
+	wb := xlsx.NewFile()
+	sh, err := wb.AddSheet("loans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := sh.AddRow()
+	for _, v := range []string{"custNo", "busiType", "inPath"} {
+		header.AddCell().SetString(v)
+	}
+	data := sh.AddRow()
+	data.AddCell().SetString("C0070001")
+	data.AddCell().SetInt(1)
+	data.AddCell().SetString("pan/C0070001.jpg")
+	data.AddCell().SetInt64(9876543210)
+	data.AddCell().SetBool(true)
+	sh.AddRow()
+	last := sh.AddRow()
+	last.AddCell().SetString("C0070002")
+	last.AddCell()
+	last.AddCell().SetString("pan/C0070001.jpg")
+
+	other, err := wb.AddSheet("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.AddRow().AddCell().SetString("ignored")
+
+	filename := filepath.Join(t.TempDir(), "loans.xlsx")
+	if err := wb.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []row{
+		{1, []string{"custNo", "busiType", "inPath", "", ""}},
+		{2, []string{"C0070001", "1", "pan/C0070001.jpg", "9876543210", "TRUE"}},
+		{4, []string{"C0070002", "", "pan/C0070001.jpg", "", ""}},
+	}
+	if got := readAll(t, filename); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// 按给定的部件写入 xlsx
+func writeParts(t *testing.T, parts map[string]string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "parts.xlsx")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zw := zip.NewWriter(file)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestReadInlineStrings(t *testing.T) {
+	filename := writeParts(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="data" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId3" Type="worksheet" Target="/xl/worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>custNo</t></si><si><r><t>in</t></r><r><t>Path</t></r><rPh><t>x</t></rPh></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row><c t="inlineStr"><is><t>C0070003</t></is></c><c/><c t="str"><v>pan/a.jpg</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	want := []row{
+		{1, []string{"custNo", "", "inPath"}},
+		{2, []string{"C0070003", "", "pan/a.jpg"}},
+	}
+	if got := readAll(t, filename); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReadNumberFormats(t *testing.T) {
+	wb := xlsx.NewFile()
+	sh, err := wb.AddSheet("loans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := sh.AddRow()
+	data.AddCell().SetFloatWithFormat(123, "00000")
+	data.AddCell().SetFloatWithFormat(1234567.5, "#,##0.00")
+	data.AddCell().SetFloatWithFormat(0.125, "0.0%")
+	data.AddCell().SetInt64(98765432101234)
+	data.AddCell().SetDate(time.Date(1990, 8, 15, 0, 0, 0, 0, time.UTC))
+	data.AddCell().SetFloatWithFormat(12.5, "0.##")
+	filename := filepath.Join(t.TempDir(), "formats.xlsx")
+	if err := wb.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []row{{1, []string{"00123", "1,234,567.50", "12.5%", "98765432101234", "1990-08-15", "12.5"}}}
+	if got := readAll(t, filename); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReadNumberFormatsFromStyles(t *testing.T) {
+	filename := writeParts(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><workbookPr date1904="1"/></workbook>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="&quot;No.&quot;000000"/><numFmt numFmtId="165" formatCode="yyyy/mm/dd hh:mm"/></numFmts>
+<cellXfs count="5"><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="165"/><xf numFmtId="49"/><xf numFmtId="11"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c><v>9.87654321E9</v></c><c s="1"><v>42</v></c><c s="2"><v>0.5</v></c><c s="3"><v>00123</v></c><c s="4"><v>1.5E+20</v></c><c s="9"><v>0.1</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	want := []row{{1, []string{"9876543210", "000042", "1904-01-01 12:00:00", "00123", "150000000000000000000", "0.1"}}}
+	if got := readAll(t, filename); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,61 @@
+package excel_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/onlythinking/pug-go/pkg/excel"
+	"github.com/tealeg/xlsx/v3"
+)
+
+func TestWriteXlsx(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "report.xlsx")
+	writer, err := excel.Create(filename, "report <1>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{
+		{"custNo", "name", "message"},
+		{"C0070001", "RAM & SONS", "<ok>"},
+		{"C0070002", "", "  spaced  "},
+	}
+	// 超过 26 列
+	wide := make([]string, 28)
+	wide[27] = "AB"
+	rows = append(rows, wide)
+	for _, cells := range rows {
+		if err := writer.Write(cells); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []row{
+		{1, rows[0]},
+		{2, rows[1]},
+		{3, rows[2]},
+		{4, wide},
+	}
+	if got := readAll(t, filename); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	wb, err := xlsx.OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := wb.Sheets[0]
+	if sh.Name != "report <1>" {
+		t.Errorf("unexpected sheet name %s", sh.Name)
+	}
+	cell, err := sh.Cell(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell.Value != "RAM & SONS" {
+		t.Errorf("unexpected cell %q", cell.Value)
+	}
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/onlythinking/pug-go/pkg/redact"
+	"go.uber.org/zap"
+)
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// 存放个人信息的列，参数按列名遮盖，不依赖值的格式（如密文、不规范的证件号）
+var sensitiveColumns = map[string]func(string) string{
+	"PAN_NO":      redact.MaskPan,
+	"CUST_NAME":   redact.MaskName,
+	"FATHER_NAME": redact.MaskName,
+	"BIRTHDAY":    redact.Mask,
+	"BIRTH_DATE":  redact.Mask,
+	"ADDRESS":     redact.Mask,
+	"PHONE_NO":    redact.Mask,
+	"REGIST_NO":   redact.Mask,
+	"EXTRA_INFO":  redact.Mask,
+	"FIELDS":      redact.Mask,
+	"PAYLOAD":     redact.Mask,
+}
+
+var (
+	insertPattern = regexp.MustCompile("(?is)^\\s*INSERT\\s+INTO\\s+\\S+\\s*\\(([^)]*)\\)")
+	// 占位符前的列名，如 `PAN_NO` = ?、CUST_NAME LIKE ?
+	columnPattern = regexp.MustCompile("(?i)`?(\\w+)`?\\s*(?:=|<>|!=|<=|>=|<|>|LIKE)\\s*$")
+)
+
+// gorm 日志输出到日志器，SQL 参数先遮盖个人信息，用于 db.SetLogger
+type GormLogger struct {
+	logger *zap.SugaredLogger
+}
+
+func NewGormLogger(logger *zap.SugaredLogger) GormLogger {
+	return GormLogger{logger: logger}
+}
+
+func (ths GormLogger) Print(values ...interface{}) {
+	if len(values) > 4 && values[0] == "sql" {
+		if vars, ok := values[4].([]interface{}); ok {
+			sql, _ := values[3].(string)
+			columns := placeholderColumns(sql)
+			masked := make([]interface{}, len(vars))
+			for i, v := range vars {
+				column := ""
+				if i < len(columns) {
+					column = columns[i]
+				}
+				masked[i] = redactVar(column, v)
+			}
+			values = append([]interface{}(nil), values...)
+			values[4] = masked
+		}
+	}
+	message := ansiPattern.ReplaceAllString(fmt.Sprint(gorm.LogFormatter(values...)...), "")
+	ths.logger.Debug(redact.String(message))
+}
+
+// 每个占位符对应的列名，无法确定时为空
+func placeholderColumns(sql string) []string {
+	var insertColumns []string
+	if match := insertPattern.FindStringSubmatch(sql); match != nil {
+		for _, column := range strings.Split(match[1], ",") {
+			insertColumns = append(insertColumns, strings.ToUpper(strings.Trim(column, "` \t\r\n")))
+		}
+	}
+
+	var columns []string
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			continue
+		}
+		column := ""
+		if insertColumns != nil {
+			// 批量插入时按列数循环
+			column = insertColumns[len(columns)%len(insertColumns)]
+		} else if match := columnPattern.FindStringSubmatch(sql[:i]); match != nil {
+			column = strings.ToUpper(match[1])
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func redactVar(column string, v interface{}) interface{} {
+	if mask, sensitive := sensitiveColumns[column]; sensitive {
+		if s, ok := stringOf(v); ok {
+			return mask(s)
+		}
+		return v
+	}
+	switch value := v.(type) {
+	case string:
+		return redact.String(value)
+	case []byte:
+		return redact.String(string(value))
+	}
+	return v
+}
+
+// 参数的文本形式，空值返回 false
+func stringOf(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case []byte:
+		return string(value), true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	return fmt.Sprint(rv.Interface()), true
+}
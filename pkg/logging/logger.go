@@ -59,7 +59,7 @@ func NewLogger(debug bool) *zap.SugaredLogger {
 		config.Development = true
 	}
 
-	logger, err := config.Build()
+	logger, err := config.Build(zap.WrapCore(newRedactCore))
 	if err != nil {
 		logger = zap.NewNop()
 	}
@@ -111,6 +111,12 @@ const (
 var logFile = "logs/app.log"
 var outputFile = []string{"stderr", fmt.Sprintf("lumberjack:%s", logFile)}
 
+// 修改日志文件路径，需在创建日志器之前调用，如测试中写入临时目录
+func SetLogFile(filename string) {
+	logFile = filename
+	outputFile = []string{"stderr", fmt.Sprintf("lumberjack:%s", logFile)}
+}
+
 var encoderConfig = zapcore.EncoderConfig{
 	TimeKey:        timestamp,
 	LevelKey:       severity,
@@ -156,85 +162,85 @@ func timeEncoder() zapcore.TimeEncoder {
 //-----------------模版方法------------------
 
 func Debug(args ...interface{}) {
-	DefaultLogger().Debug(args)
+	DefaultLogger().Debug(args...)
 }
 
 func Info(args ...interface{}) {
-	DefaultLogger().Info(args)
+	DefaultLogger().Info(args...)
 }
 
 func Warn(args ...interface{}) {
-	DefaultLogger().Warn(args)
+	DefaultLogger().Warn(args...)
 }
 
 func Error(args ...interface{}) {
-	DefaultLogger().Error(args)
+	DefaultLogger().Error(args...)
 }
 
 func DPanic(args ...interface{}) {
-	DefaultLogger().DPanic(args)
+	DefaultLogger().DPanic(args...)
 }
 
 func Panic(args ...interface{}) {
-	DefaultLogger().Panic(args)
+	DefaultLogger().Panic(args...)
 }
 
 func Fatal(args ...interface{}) {
-	DefaultLogger().Fatal(args)
+	DefaultLogger().Fatal(args...)
 }
 
 func Debugf(template string, args ...interface{}) {
-	DefaultLogger().Debugf(template, args)
+	DefaultLogger().Debugf(template, args...)
 }
 
 func Infof(template string, args ...interface{}) {
-	DefaultLogger().Infof(template, args)
+	DefaultLogger().Infof(template, args...)
 }
 
 func Warnf(template string, args ...interface{}) {
-	DefaultLogger().Warnf(template, args)
+	DefaultLogger().Warnf(template, args...)
 }
 
 func Errorf(template string, args ...interface{}) {
-	DefaultLogger().Errorf(template, args)
+	DefaultLogger().Errorf(template, args...)
 }
 
 func DPanicf(template string, args ...interface{}) {
-	DefaultLogger().DPanicf(template, args)
+	DefaultLogger().DPanicf(template, args...)
 }
 
 func Panicf(template string, args ...interface{}) {
-	DefaultLogger().Panicf(template, args)
+	DefaultLogger().Panicf(template, args...)
 }
 
 func Fatalf(template string, args ...interface{}) {
-	DefaultLogger().Fatalf(template, args)
+	DefaultLogger().Fatalf(template, args...)
 }
 
 func Debugw(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().Debugw(msg, keysAndValues)
+	DefaultLogger().Debugw(msg, keysAndValues...)
 }
 
 func Infow(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().Infow(msg, keysAndValues)
+	DefaultLogger().Infow(msg, keysAndValues...)
 }
 
 func Warnw(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().Warnw(msg, keysAndValues)
+	DefaultLogger().Warnw(msg, keysAndValues...)
 }
 
 func Errorw(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().Errorw(msg, keysAndValues)
+	DefaultLogger().Errorw(msg, keysAndValues...)
 }
 
 func DPanicw(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().DPanicw(msg, keysAndValues)
+	DefaultLogger().DPanicw(msg, keysAndValues...)
 }
 
 func Panicw(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().Panicw(msg, keysAndValues)
+	DefaultLogger().Panicw(msg, keysAndValues...)
 }
 
 func Fatalw(msg string, keysAndValues ...interface{}) {
-	DefaultLogger().Fatalw(msg, keysAndValues)
+	DefaultLogger().Fatalw(msg, keysAndValues...)
 }
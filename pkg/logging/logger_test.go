@@ -2,9 +2,13 @@ package logging_test
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/onlythinking/pug-go/pkg/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestNewLogger(t *testing.T) {
@@ -50,3 +54,54 @@ func TestContext(t *testing.T) {
 		t.Errorf("expected %#v to be %#v", logger1, logger2)
 	}
 }
+
+func TestGormLoggerRedacts(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zap.DebugLevel)
+	gormLogger := logging.NewGormLogger(zap.New(core).Sugar())
+	gormLogger.Print("sql", "loan.go:10", time.Millisecond,
+		"INSERT INTO `cu_cust_ocr_result_dtl` (`PAN_NO`,`REMARK`) VALUES (?,?)",
+		[]interface{}{"ABCPK1234F", `{"name":"RAVI KUMAR"}`}, int64(1))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	message := entries[0].Message
+	if strings.Contains(message, "ABCPK1234F") || strings.Contains(message, "RAVI KUMAR") || !strings.Contains(message, "AB******4F") {
+		t.Errorf("expected masked sql, got %s", message)
+	}
+}
+
+func TestGormLoggerRedactsColumns(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zap.DebugLevel)
+	gormLogger := logging.NewGormLogger(zap.New(core).Sugar())
+	// 不规范的证件号、密文和日期无法按格式识别，按列名遮盖
+	gormLogger.Print("sql", "loan.go:10", time.Millisecond,
+		"INSERT INTO `cu_cust_ocr_result_dtl` (`CUST_NO`,`PAN_NO`,`CUST_NAME`,`BIRTH_DATE`) VALUES (?,?,?,?)",
+		[]interface{}{"C0010001", "ABCPK12S4F", "RAVI KUMAR", "enc:v1:c2VjcmV0"}, int64(1))
+	gormLogger.Print("sql", "loan.go:20", time.Millisecond,
+		"UPDATE `cu_cust_ocr_result_dtl` SET `CUST_NAME` = ?, `BIRTHDAY` = ? WHERE (CUST_NO = ?)",
+		[]interface{}{"SITA DEVI", "15/08/1990", "C0010001"}, int64(1))
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		for _, value := range []string{"ABCPK12S4F", "RAVI KUMAR", "c2VjcmV0", "SITA DEVI", "15/08/1990"} {
+			if strings.Contains(entry.Message, value) {
+				t.Errorf("expected %s masked, got %s", value, entry.Message)
+			}
+		}
+		if !strings.Contains(entry.Message, "C0010001") {
+			t.Errorf("expected customer number kept, got %s", entry.Message)
+		}
+	}
+	if !strings.Contains(entries[0].Message, "AB******4F") || !strings.Contains(entries[1].Message, "S*** D***") {
+		t.Errorf("unexpected masked sql %s %s", entries[0].Message, entries[1].Message)
+	}
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"github.com/onlythinking/pug-go/pkg/redact"
+	"go.uber.org/zap/zapcore"
+)
+
+// 写出前遮盖消息和字符串字段中的个人信息
+type redactCore struct {
+	zapcore.Core
+}
+
+func newRedactCore(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core}
+}
+
+func (ths *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: ths.Core.With(redactFields(fields))}
+}
+
+func (ths *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ths.Enabled(ent.Level) {
+		return ce.AddCore(ent, ths)
+	}
+	return ce
+}
+
+func (ths *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = redact.String(ent.Message)
+	return ths.Core.Write(ent, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, field := range fields {
+		if field.Type != zapcore.StringType {
+			continue
+		}
+		if masked := redact.String(field.String); masked != field.String {
+			if out == nil {
+				out = append([]zapcore.Field(nil), fields...)
+			}
+			out[i].String = masked
+		}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
@@ -0,0 +1,303 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/onlythinking/pug-go/pkg/logging"
+)
+
+// 记录已执行版本的表
+const VersionTable = "schema_version"
+
+// 迁移文件名，如 0001_init.up.sql、0001_init.down.sql
+var fileName = regexp.MustCompile(`^(\d+)_([0-9A-Za-z_]+)\.(up|down)\.sql$`)
+
+// 脚本中的前置检查，如 -- abort-if: SELECT 1 FROM t WHERE ...，查询有结果时不执行脚本
+const abortIfPrefix = "-- abort-if:"
+
+// 一个版本的迁移，Down 为空表示不可回滚
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// 迁移及其执行情况
+type State struct {
+	Migration
+	Applied     bool
+	AppliedTime time.Time
+}
+
+// 版本化迁移，按版本号顺序执行 SQL 文件并记录到 VersionTable
+// MySQL 的 DDL 会隐式提交，迁移中途失败时需人工处理已执行的语句
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// 读取根目录下的迁移文件，按版本号排序
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// 所有迁移，以及库中有记录但本地没有的版本
+func (ths *Migrator) Status(ctx context.Context) ([]State, error) {
+	applied, err := ths.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]State, 0, len(ths.migrations))
+	known := make(map[int]bool, len(ths.migrations))
+	for _, m := range ths.migrations {
+		known[m.Version] = true
+		appliedTime, ok := applied[m.Version]
+		states = append(states, State{Migration: m, Applied: ok, AppliedTime: appliedTime})
+	}
+	for version, appliedTime := range applied {
+		if !known[version] {
+			states = append(states, State{Migration: Migration{Version: version, Name: "?"}, Applied: true, AppliedTime: appliedTime})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Version < states[j].Version
+	})
+	return states, nil
+}
+
+// 未执行的迁移
+func (ths *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := ths.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range ths.migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// 按顺序执行未执行的迁移，steps <= 0 时全部执行
+func (ths *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	pending, err := ths.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	var done []Migration
+	for _, m := range pending {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		log.Infof("Migrate up %04d_%s", m.Version, m.Name)
+		err := ths.exec(ctx, m.Up, "INSERT INTO "+VersionTable+" (VERSION, NAME, APPLIED_TIME) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now())
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// 从最新版本开始回滚 steps 个迁移，steps 至少为 1
+func (ths *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("invalid steps %d, must be at least 1", steps)
+	}
+	applied, err := ths.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	byVersion := make(map[int]Migration, len(ths.migrations))
+	for _, m := range ths.migrations {
+		byVersion[m.Version] = m
+	}
+	var done []Migration
+	for _, version := range versions {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			return done, fmt.Errorf("migration %d not found", version)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			return done, fmt.Errorf("migration %04d_%s is irreversible", m.Version, m.Name)
+		}
+		log.Infof("Migrate down %04d_%s", m.Version, m.Name)
+		if err := ths.exec(ctx, m.Down, "DELETE FROM "+VersionTable+" WHERE VERSION = ?", m.Version); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// 在同一事务中执行脚本并更新版本记录，前置检查不通过时返回错误
+func (ths *Migrator) exec(ctx context.Context, script string, record string, args ...interface{}) error {
+	tx, err := ths.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, query := range AbortIfs(script) {
+		if err := abortIf(ctx, tx, query); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, stmt := range Statements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func abortIf(ctx context.Context, tx *sql.Tx, query string) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("abort-if %q: %w", query, err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return fmt.Errorf("aborted, existing data matches %q", query)
+	}
+	return rows.Err()
+}
+
+func (ths *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	_, err := ths.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+VersionTable+
+		" (VERSION INT NOT NULL PRIMARY KEY, NAME VARCHAR(200) NOT NULL, APPLIED_TIME DATETIME NOT NULL)")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ths.db.QueryContext(ctx, "SELECT VERSION, APPLIED_TIME FROM "+VersionTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedTime time.Time
+		if err := rows.Scan(&version, &appliedTime); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedTime
+	}
+	return applied, rows.Err()
+}
+
+// 按行尾的分号拆分语句，忽略 -- 开头的注释行
+func Statements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
+
+// 脚本中 -- abort-if: 注释行的查询，每行一条
+func AbortIfs(script string) []string {
+	var queries []string
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, abortIfPrefix) {
+			queries = append(queries, strings.TrimSuffix(strings.TrimSpace(trimmed[len(abortIfPrefix):]), ";"))
+		}
+	}
+	return queries
+}
@@ -0,0 +1,158 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/onlythinking/pug-go/pkg/logging"
+	"github.com/onlythinking/pug-go/pkg/migrate"
+)
+
+// 日志写入临时目录
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "migrate-test")
+	if err != nil {
+		panic(err)
+	}
+	logging.SetLogFile(filepath.Join(dir, "app.log"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func hasTable(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+var fsys = fstest.MapFS{
+	"0001_init.up.sql":     file("-- 初始化\nCREATE TABLE a (id int);\nCREATE TABLE b (id int);\n"),
+	"0001_init.down.sql":   file("DROP TABLE b;\nDROP TABLE a;\n"),
+	"0002_more.up.sql":     file("CREATE TABLE more (\n    id int\n);\n"),
+	"0002_more.down.sql":   file("DROP TABLE more;\n"),
+	"0003_c.up.sql":        file("CREATE TABLE c (id int);"),
+	"0003_c.down.sql":      file("DROP TABLE c;"),
+	"README.md":            file("ignored"),
+	"0004_broken.up.sql":   file("CREATE TABLE d (id int);\nCREATE TABLE broken (;\n"),
+	"0004_broken.down.sql": file("DROP TABLE d;"),
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, err := migrate.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(ctx, 2)
+	if err != nil || len(done) != 2 || done[1].Name != "more" {
+		t.Fatalf("unexpected up %v %v", done, err)
+	}
+	pending, _ := m.Pending(ctx)
+	if len(pending) != 2 || pending[0].Version != 3 {
+		t.Fatalf("unexpected pending %v", pending)
+	}
+
+	// 失败的迁移整体回滚且不记录版本
+	done, err = m.Up(ctx, 0)
+	if err == nil || len(done) != 1 {
+		t.Fatalf("expected 0004 to fail, got %v %v", done, err)
+	}
+	if hasTable(t, db, "d") {
+		t.Error("expected failed migration rolled back")
+	}
+	states, err := m.Status(ctx)
+	if err != nil || len(states) != 4 || !states[2].Applied || states[3].Applied || states[0].AppliedTime.IsZero() {
+		t.Fatalf("unexpected status %v %v", states, err)
+	}
+
+	for _, steps := range []int{0, -1} {
+		if done, err := m.Down(ctx, steps); err == nil || len(done) != 0 {
+			t.Errorf("expected invalid steps %d rejected, got %v %v", steps, done, err)
+		}
+	}
+	done, err = m.Down(ctx, 2)
+	if err != nil || len(done) != 2 || done[0].Version != 3 || done[1].Version != 2 {
+		t.Fatalf("unexpected down %v %v", done, err)
+	}
+	if hasTable(t, db, "c") || hasTable(t, db, "more") || !hasTable(t, db, "a") {
+		t.Error("unexpected tables after down")
+	}
+}
+
+func TestAbortIf(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, err := migrate.New(db, fstest.MapFS{
+		"0001_init.up.sql": file("CREATE TABLE a (name varchar(40));\nINSERT INTO a VALUES ('enc:v1:x');\n"),
+		// 已有密文时拒绝回滚
+		"0001_init.down.sql": file("-- abort-if: SELECT 1 FROM a WHERE name LIKE 'enc:v1:%';\nDROP TABLE a;\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Down(ctx, 1)
+	if err == nil || len(done) != 0 || !strings.Contains(err.Error(), "aborted") {
+		t.Fatalf("expected down aborted, got %v %v", done, err)
+	}
+	if states, _ := m.Status(ctx); !hasTable(t, db, "a") || !states[0].Applied {
+		t.Fatal("expected nothing rolled back")
+	}
+
+	if _, err := db.Exec("DELETE FROM a"); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := m.Down(ctx, 1); err != nil || len(done) != 1 || hasTable(t, db, "a") {
+		t.Errorf("unexpected down %v %v", done, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := migrate.Load(fstest.MapFS{"0001_a.down.sql": file("DROP TABLE a;")}); err == nil {
+		t.Error("expected error for missing up script")
+	}
+	if _, err := migrate.Load(fstest.MapFS{"0001_a.up.sql": file("SELECT 1;"), "0001_b.down.sql": file("SELECT 1;")}); err == nil {
+		t.Error("expected error for mismatched names")
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := "-- comment\n-- abort-if: SELECT 1 FROM a;\nCREATE TABLE a (\n  id int -- key\n);\n\nINSERT INTO a VALUES (1);\nSELECT 1"
+	stmts := migrate.Statements(script)
+	if len(stmts) != 3 || stmts[0] != "CREATE TABLE a (\n  id int -- key\n)" || stmts[2] != "SELECT 1" {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+	if queries := migrate.AbortIfs(script); len(queries) != 1 || queries[0] != "SELECT 1 FROM a" {
+		t.Errorf("unexpected abort-if queries %q", queries)
+	}
+}
@@ -1,8 +1,6 @@
 package domain
 
 import (
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
 	"hash/crc32"
 	"time"
@@ -47,14 +45,3 @@ func (ths Domain) PrePersist() {
 func (ths Domain) PreUpdate() {
 	ths.LastModifiedTime = time.Now()
 }
-
-//*************** https://gorm.io/docs ******************************
-var dbTp *gorm.DB
-
-func Init(db *gorm.DB) {
-	dbTp = db
-}
-
-func (ths PersistentDomain) SqlTemplate() *gorm.DB {
-	return dbTp
-}
@@ -31,10 +31,16 @@ type S3Client struct {
 	defaultBucket string
 }
 
-// S3 批量下载器
+// S3 批量下载器，支持从多个桶下载，非默认桶按所在区域创建下载器
 type S3Downloader struct {
 	*s3manager.Downloader
 	defaultBucket string
+	parser        *URLParser
+	sess          *session.Session
+
+	mu          sync.Mutex
+	regions     map[string]string                // bucket -> region
+	downloaders map[string]*s3manager.Downloader // region -> 下载器
 }
 
 // S3 批量上传器
@@ -246,16 +252,61 @@ func NewS3Downloader() *S3Downloader {
 		log.Error("Create s3 downloader err", err)
 	}
 
+	parser, err := NewURLParserFromConfig()
+	if err != nil {
+		log.Errorf("Create s3 url parser err: %s", err)
+		parser, _ = NewURLParser(cfg.Oss.DefaultBucket)
+	}
+
+	return &S3Downloader{
+		Downloader:    newDownloader(sess),
+		defaultBucket: cfg.Oss.DefaultBucket,
+		parser:        parser,
+		sess:          sess,
+		regions:       map[string]string{},
+		downloaders:   map[string]*s3manager.Downloader{},
+	}
+}
+
+func newDownloader(sess *session.Session) *s3manager.Downloader {
 	// 以下参数根据下载文件大小和CPU内存进行调配
 	// PartSize    下载增量大小 5MB (1024 * 1024 * 5)
 	// Concurrency 下载启动的goroutine数量 默认 5
-	svc := s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
+	return s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
 		d.PartSize = 1024 * 1024 * 5
 		d.Concurrency = 8
 	})
-	return &S3Downloader{
-		Downloader:    svc,
-		defaultBucket: cfg.Oss.DefaultBucket}
+}
+
+// 按桶所在区域选择下载器，默认桶或查询区域失败时使用默认下载器
+func (ths *S3Downloader) downloaderFor(ctx context.Context, bucket string) *s3manager.Downloader {
+	if bucket == ths.defaultBucket || ths.sess == nil {
+		return ths.Downloader
+	}
+	defaultRegion := aws.StringValue(ths.sess.Config.Region)
+
+	ths.mu.Lock()
+	defer ths.mu.Unlock()
+
+	region, ok := ths.regions[bucket]
+	if !ok {
+		var err error
+		region, err = s3manager.GetBucketRegion(ctx, ths.sess, bucket, defaultRegion)
+		if err != nil {
+			log.Errorf("Get bucket %s region err: %s", bucket, err)
+			return ths.Downloader
+		}
+		ths.regions[bucket] = region
+	}
+	if region == defaultRegion {
+		return ths.Downloader
+	}
+	downloader, ok := ths.downloaders[region]
+	if !ok {
+		downloader = newDownloader(ths.sess.Copy(&aws.Config{Region: aws.String(region)}))
+		ths.downloaders[region] = downloader
+	}
+	return downloader
 }
 
 // 创建S3下载器
@@ -288,13 +339,14 @@ func NewS3Uploader() *S3Uploader {
 // s3 objectKey 集合
 var lock = sync.Mutex{}
 
-func (ths *S3Downloader) BatchDownload(baseDir string, keys []string) error {
+func (ths *S3Downloader) BatchDownload(ctx context.Context, baseDir string, keys []string) error {
 
 	lock.Lock()
 	if ok, _ := help.PathExists(baseDir); !ok {
 		// 创建目录
 		err := os.Mkdir(baseDir, os.ModePerm)
 		if err != nil {
+			lock.Unlock()
 			log.Errorf("Create dir %s fail on batch download ", err)
 			return err
 		}
@@ -308,49 +360,97 @@ func (ths *S3Downloader) BatchDownload(baseDir string, keys []string) error {
 	//	return err
 	//}
 
-	var objects []s3manager.BatchDownloadObject
-
-	var bucketName = ths.getDefaultBucket()
+	// 逐个下载，每个文件下载完即关闭，失败的不完整文件会被删除
+	var errs []s3manager.Error
 	var keyCount = len(keys)
+	log.Debugf("----------------------Download total: %d--------------------------", keyCount)
 	for _, key := range keys {
-		// 创建Key文件
-		fileName := filepath.Join(baseDir, key)
-		err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
-		if nil != err {
-			log.Errorf("Create key %s dir err", err)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		object, err := ths.parser.Parse(key)
+		if err != nil {
+			log.Errorf("Parse key %s err: %s", key, err)
 			continue
 		}
 
-		tmpFile, err := os.Create(fileName)
+		// 创建Key文件
+		fileName := filepath.Join(baseDir, ths.parser.localPath(object))
+		err = os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
 		if nil != err {
-			log.Errorf("Create key file %s  err", err)
+			log.Errorf("Create key %s dir err", err)
 			continue
 		}
 
-		objects = append(objects, s3manager.BatchDownloadObject{
-			Object: &s3.GetObjectInput{
-				Bucket: aws.String(bucketName),
-				Key:    aws.String(key),
-			},
-			Writer: tmpFile,
-			After: func() error {
-				keyCount--
-				log.Debugf("Remaining %s", strconv.Itoa(keyCount))
-				if keyCount <= 0 {
-					log.Debug("----------------------Download done--------------------------")
-				}
-				return nil
-			},
-		})
+		if err := ths.downloadFile(ctx, object, fileName); err != nil {
+			errs = append(errs, s3manager.Error{OrigErr: err, Bucket: aws.String(object.Bucket), Key: aws.String(object.Key)})
+		}
+		keyCount--
+		log.Debugf("Remaining %s", strconv.Itoa(keyCount))
 	}
+	log.Debug("----------------------Download done--------------------------")
 
-	log.Debugf("----------------------Download total: %d--------------------------", len(keys))
+	if len(errs) > 0 {
+		return s3manager.NewBatchError("BatchedDownloadIncomplete", "some objects have failed to download.", errs)
+	}
+	return nil
+}
 
-	iter := &s3manager.DownloadObjectsIterator{Objects: objects}
-	if err := ths.Downloader.DownloadWithIterator(aws.BackgroundContext(), iter); err != nil {
+// 下载到本地文件，失败时删除不完整的文件，避免被当作已下载
+func (ths *S3Downloader) downloadFile(ctx context.Context, object ObjectRef, fileName string) error {
+	tmpFile, err := os.Create(fileName)
+	if nil != err {
 		return err
 	}
-	return nil
+	_, err = ths.downloaderFor(ctx, object.Bucket).DownloadWithContext(ctx, tmpFile, &s3.GetObjectInput{
+		Bucket: aws.String(object.Bucket),
+		Key:    aws.String(object.Key),
+	})
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fileName)
+	}
+	return err
+}
+
+// 下载单个文件到内存，key 可以是默认桶的 key 或其他桶的地址
+func (ths *S3Downloader) Download(ctx context.Context, key string) ([]byte, error) {
+	object, err := ths.parser.Parse(key)
+	if err != nil {
+		return nil, pugerr.ViolationErrorWithErr("invalid key "+key, err)
+	}
+	buf := aws.NewWriteAtBuffer(nil)
+	_, err = ths.downloaderFor(ctx, object.Bucket).DownloadWithContext(ctx, buf, &s3.GetObjectInput{
+		Bucket: aws.String(object.Bucket),
+		Key:    aws.String(object.Key),
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// 查询对象 ETag，不下载内容
+func (ths *S3Downloader) ETag(ctx context.Context, key string) (string, error) {
+	object, err := ths.parser.Parse(key)
+	if err != nil {
+		return "", pugerr.ViolationErrorWithErr("invalid key "+key, err)
+	}
+	output, err := ths.downloaderFor(ctx, object.Bucket).S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(object.Bucket),
+		Key:    aws.String(object.Key),
+	})
+	if err != nil {
+		return "", handleError(err)
+	}
+	return aws.StringValue(output.ETag), nil
+}
+
+// 图片地址解析器
+func (ths *S3Downloader) URLParser() *URLParser {
+	return ths.parser
 }
 
 // 上传单个大文件
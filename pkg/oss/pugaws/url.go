@@ -0,0 +1,159 @@
+package pugaws
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/onlythinking/pug-go/internal/config"
+)
+
+var (
+	// s3.amazonaws.com, s3.ap-south-1.amazonaws.com, s3-ap-south-1.amazonaws.com, s3.dualstack.ap-south-1.amazonaws.com
+	pathStyleHost = regexp.MustCompile(`^s3(?:[.-](?:dualstack\.)?[a-z0-9-]+)?\.amazonaws\.com(?:\.cn)?$`)
+	// bucket.s3.amazonaws.com, bucket.s3.ap-south-1.amazonaws.com, bucket.s3-ap-south-1.amazonaws.com
+	virtualHost = regexp.MustCompile(`^(.+)\.s3(?:[.-](?:dualstack\.)?[a-z0-9-]+)?\.amazonaws\.com(?:\.cn)?$`)
+)
+
+// S3 对象位置
+type ObjectRef struct {
+	Bucket string
+	Key    string
+}
+
+// 图片地址解析：s3://bucket/key、S3 的虚拟主机和路径两种地址、
+// 自定义域名（如 CloudFront，对应默认桶）以及不带域名的 key
+type URLParser struct {
+	defaultBucket string
+	domains       []*url.URL
+}
+
+// domainUrls 为默认桶的访问域名，可带路径前缀
+func NewURLParser(defaultBucket string, domainUrls ...string) (*URLParser, error) {
+	parser := &URLParser{defaultBucket: defaultBucket}
+	for _, domainUrl := range domainUrls {
+		domainUrl = strings.TrimSpace(domainUrl)
+		if domainUrl == "" {
+			continue
+		}
+		if !strings.Contains(domainUrl, "://") {
+			domainUrl = "https://" + domainUrl
+		}
+		u, err := url.Parse(domainUrl)
+		if err != nil {
+			return nil, fmt.Errorf("domainUrl %s: %w", domainUrl, err)
+		}
+		u.Host = strings.ToLower(u.Hostname())
+		u.Path = strings.Trim(u.Path, "/")
+		parser.domains = append(parser.domains, u)
+	}
+	return parser, nil
+}
+
+// 按配置创建，Oss.DomainUrl 可配置多个域名，逗号分隔
+func NewURLParserFromConfig() (*URLParser, error) {
+	cfg := config.App()
+	return NewURLParser(cfg.Oss.DefaultBucket, strings.Split(cfg.Oss.DomainUrl, ",")...)
+}
+
+func (ths *URLParser) DefaultBucket() string {
+	return ths.defaultBucket
+}
+
+// 解析图片地址
+func (ths *URLParser) Parse(ref string) (ObjectRef, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ObjectRef{}, fmt.Errorf("empty object reference")
+	}
+
+	lower := strings.ToLower(ref)
+	switch {
+	case strings.HasPrefix(lower, "s3://"):
+		// s3:// 中的 key 不做 URL 解码
+		parts := strings.SplitN(ref[len("s3://"):], "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return ObjectRef{}, fmt.Errorf("invalid s3 url %s", ref)
+		}
+		return ObjectRef{Bucket: parts[0], Key: parts[1]}, nil
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		return ths.parseHttp(ref)
+	case strings.Contains(ref, "://"):
+		return ObjectRef{}, fmt.Errorf("unsupported url %s", ref)
+	}
+	return ObjectRef{Bucket: ths.defaultBucket, Key: ref}, nil
+}
+
+func (ths *URLParser) parseHttp(ref string) (ObjectRef, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ObjectRef{}, err
+	}
+	host := strings.ToLower(u.Hostname())
+	path := strings.TrimPrefix(u.Path, "/")
+
+	for _, domain := range ths.domains {
+		if host != domain.Host {
+			continue
+		}
+		if domain.Path == "" {
+			return ths.object(ths.defaultBucket, path, ref)
+		}
+		if strings.HasPrefix(path, domain.Path+"/") {
+			return ths.object(ths.defaultBucket, strings.TrimPrefix(path, domain.Path+"/"), ref)
+		}
+	}
+
+	if pathStyleHost.MatchString(host) {
+		parts := strings.SplitN(path, "/", 2)
+		if len(parts) != 2 {
+			return ObjectRef{}, fmt.Errorf("invalid s3 url %s", ref)
+		}
+		return ths.object(parts[0], parts[1], ref)
+	}
+	if m := virtualHost.FindStringSubmatch(host); m != nil {
+		return ths.object(m[1], path, ref)
+	}
+	return ObjectRef{}, fmt.Errorf("%s is not an s3 url or configured domain", ref)
+}
+
+func (ths *URLParser) object(bucket string, key string, ref string) (ObjectRef, error) {
+	if bucket == "" || key == "" {
+		return ObjectRef{}, fmt.Errorf("invalid s3 url %s", ref)
+	}
+	return ObjectRef{Bucket: bucket, Key: key}, nil
+}
+
+// 统一格式：默认桶的对象只保留 key，其他桶为 s3://bucket/key
+func (ths *URLParser) Normalize(ref string) (string, error) {
+	object, err := ths.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return ths.Format(object), nil
+}
+
+func (ths *URLParser) Format(object ObjectRef) string {
+	if object.Bucket == "" || object.Bucket == ths.defaultBucket {
+		return object.Key
+	}
+	return "s3://" + object.Bucket + "/" + object.Key
+}
+
+// 下载到本地时的相对路径：默认桶为 key，其他桶为 bucket/key
+func (ths *URLParser) LocalPath(ref string) string {
+	object, err := ths.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return ths.localPath(object)
+}
+
+func (ths *URLParser) localPath(object ObjectRef) string {
+	if object.Bucket == "" || object.Bucket == ths.defaultBucket {
+		return filepath.FromSlash(object.Key)
+	}
+	return filepath.Join(object.Bucket, filepath.FromSlash(object.Key))
+}
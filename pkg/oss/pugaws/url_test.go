@@ -0,0 +1,85 @@
+package pugaws_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onlythinking/pug-go/pkg/oss/pugaws"
+)
+
+func TestURLParser(t *testing.T) {
+	parser, err := pugaws.NewURLParser("qt-fpdl-app", "https://d1234.cloudfront.net/img/", "static.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref    string
+		bucket string
+		key    string
+	}{
+		{"pan/C0060001.jpg", "qt-fpdl-app", "pan/C0060001.jpg"},
+		{"https://qt-fpdl-app.s3.ap-south-1.amazonaws.com/pan/C0060001.jpg", "qt-fpdl-app", "pan/C0060001.jpg"},
+		{"https://qt-fpdl-app.s3.amazonaws.com/pan/C0060001.jpg", "qt-fpdl-app", "pan/C0060001.jpg"},
+		{"http://qt-fpdl-bak.s3-ap-south-1.amazonaws.com/pan/C0060001.jpg", "qt-fpdl-bak", "pan/C0060001.jpg"},
+		{"https://s3.ap-south-1.amazonaws.com/qt-fpdl-bak/pan/C0060001.jpg", "qt-fpdl-bak", "pan/C0060001.jpg"},
+		{"https://my.bucket.s3.us-east-1.amazonaws.com/pan/a.jpg?X-Amz-Expires=60", "my.bucket", "pan/a.jpg"},
+		{"s3://qt-fpdl-bak/pan/C0060001 1.jpg", "qt-fpdl-bak", "pan/C0060001 1.jpg"},
+		{"https://qt-fpdl-app.s3.ap-south-1.amazonaws.com/pan/C0060001%201.jpg", "qt-fpdl-app", "pan/C0060001 1.jpg"},
+		{"https://d1234.cloudfront.net/img/pan/C0060001.jpg", "qt-fpdl-app", "pan/C0060001.jpg"},
+		{"https://STATIC.example.com/pan/C0060001.jpg", "qt-fpdl-app", "pan/C0060001.jpg"},
+	}
+	for _, tt := range tests {
+		object, err := parser.Parse(tt.ref)
+		if err != nil {
+			t.Errorf("Parse(%q) err: %s", tt.ref, err)
+			continue
+		}
+		if object.Bucket != tt.bucket || object.Key != tt.key {
+			t.Errorf("Parse(%q) = %+v, expected %s %s", tt.ref, object, tt.bucket, tt.key)
+		}
+	}
+
+	for _, ref := range []string{
+		"",
+		"https://example.com/pan/C0060001.jpg",
+		"https://d1234.cloudfront.net/other/C0060001.jpg",
+		"https://s3.amazonaws.com/qt-fpdl-app",
+		"ftp://qt-fpdl-app/pan/C0060001.jpg",
+		"s3://qt-fpdl-app/",
+	} {
+		if object, err := parser.Parse(ref); err == nil {
+			t.Errorf("Parse(%q) expected error, got %+v", ref, object)
+		}
+	}
+}
+
+func TestURLParserNormalize(t *testing.T) {
+	parser, err := pugaws.NewURLParser("qt-fpdl-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref       string
+		key       string
+		localPath string
+	}{
+		{"https://qt-fpdl-app.s3.ap-south-1.amazonaws.com/pan/a.jpg", "pan/a.jpg", "pan/a.jpg"},
+		{"s3://qt-fpdl-app/pan/a.jpg", "pan/a.jpg", "pan/a.jpg"},
+		{"https://qt-fpdl-bak.s3.ap-south-1.amazonaws.com/pan/a.jpg", "s3://qt-fpdl-bak/pan/a.jpg", "qt-fpdl-bak/pan/a.jpg"},
+	}
+	for _, tt := range tests {
+		key, err := parser.Normalize(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != tt.key {
+			t.Errorf("Normalize(%q) = %s, expected %s", tt.ref, key, tt.key)
+		}
+		// 统一后的地址解析结果不变
+		if localPath := parser.LocalPath(key); localPath != filepath.FromSlash(tt.localPath) {
+			t.Errorf("LocalPath(%q) = %s, expected %s", key, localPath, tt.localPath)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package pugcrypto_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/onlythinking/pug-go/pkg/pugcrypto"
+)
+
+func TestCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	c, err := pugcrypto.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := c.Encrypt("ABCPK1234F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := c.Encrypt("ABCPK1234F")
+	if !pugcrypto.IsEncrypted(first) || strings.Contains(first, "ABCPK") || first == second {
+		t.Errorf("unexpected ciphertext %s %s", first, second)
+	}
+	if again, _ := c.Encrypt(first); again != first {
+		t.Error("expected ciphertext not encrypted twice")
+	}
+	if plain, err := c.Decrypt(first); err != nil || plain != "ABCPK1234F" {
+		t.Errorf("unexpected plain %q %v", plain, err)
+	}
+	if plain, err := c.Decrypt("LEGACY"); err != nil || plain != "LEGACY" {
+		t.Errorf("expected plaintext kept, got %q %v", plain, err)
+	}
+
+	other, _ := pugcrypto.NewCipher(bytes.Repeat([]byte{8}, 32))
+	if _, err := other.Decrypt(first); err == nil {
+		t.Error("expected error with another key")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	for _, encoded := range []string{base64.StdEncoding.EncodeToString(key), strings.Repeat("01", 32)} {
+		if got, err := pugcrypto.ParseKey(encoded); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("%s: unexpected %v %v", encoded, got, err)
+		}
+	}
+	if _, err := pugcrypto.ParseKey("short"); err == nil {
+		t.Error("expected error for short key")
+	}
+}
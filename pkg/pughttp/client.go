@@ -0,0 +1,121 @@
+package pughttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+)
+
+// 未配置时的默认值
+const (
+	defaultTimeout             = 60 * time.Second
+	defaultConnectTimeout      = 5 * time.Second
+	defaultReadTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+	tlsHandshakeTimeout        = 10 * time.Second
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 创建对外调用的 HTTP 客户端，连接池在所有请求间复用，应创建一次后共享
+// 传输层经 OpenCensus 包装，请求会生成 span 并透传 trace 上下文
+func New(cfg config.HttpClientConfig) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		proxyUrl, err := url.Parse(cfg.Proxy)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", cfg.Proxy)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   seconds(cfg.ConnectTimeout, defaultConnectTimeout),
+		KeepAlive: seconds(cfg.KeepAlive, defaultKeepAlive),
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: seconds(cfg.ReadTimeout, defaultReadTimeout),
+		MaxIdleConns:          positive(cfg.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   positive(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		IdleConnTimeout:       seconds(cfg.IdleConnTimeout, defaultIdleConnTimeout),
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	return &http.Client{
+		Transport: &ochttp.Transport{
+			Base:        transport,
+			Propagation: &tracecontext.HTTPFormat{},
+		},
+		Timeout: seconds(cfg.Timeout, defaultTimeout),
+	}, nil
+}
+
+func newTLSConfig(cfg config.HttpClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.Tls.InsecureSkipVerify,
+	}
+	if cfg.Tls.MinVersion != "" {
+		version, ok := tlsVersions[cfg.Tls.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls version %q", cfg.Tls.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if cfg.Tls.CaFile != "" {
+		pem, err := ioutil.ReadFile(cfg.Tls.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.Tls.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func seconds(value int, def time.Duration) time.Duration {
+	if value <= 0 {
+		return def
+	}
+	return time.Duration(value) * time.Second
+}
+
+func positive(value int, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,56 @@
+package pughttp_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onlythinking/pug-go/internal/config"
+	"github.com/onlythinking/pug-go/pkg/pughttp"
+)
+
+func TestClientThroughProxy(t *testing.T) {
+	var traceparent, target string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		target = r.URL.String()
+		w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	client, err := pughttp.New(config.HttpClientConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://event.example.com/record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if string(body) != "ok" || target != "http://event.example.com/record" {
+		t.Errorf("expected request through proxy, got %q %q", body, target)
+	}
+	if traceparent == "" {
+		t.Error("expected trace context header")
+	}
+}
+
+func TestClientInvalidConfig(t *testing.T) {
+	cfgs := map[string]config.HttpClientConfig{}
+	cfgs["proxy"] = config.HttpClientConfig{Proxy: "://bad"}
+	tlsVersion := config.HttpClientConfig{}
+	tlsVersion.Tls.MinVersion = "2.0"
+	cfgs["tls"] = tlsVersion
+	caFile := config.HttpClientConfig{}
+	caFile.Tls.CaFile = "testdata/missing.pem"
+	cfgs["ca"] = caFile
+
+	for name, cfg := range cfgs {
+		if _, err := pughttp.New(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
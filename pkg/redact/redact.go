@@ -0,0 +1,120 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSON 中需要遮盖的字段，比较时忽略大小写
+var sensitiveKeys = map[string]func(string) string{
+	"idnumber":     MaskPan,
+	"panno":        MaskPan,
+	"name":         MaskName,
+	"custname":     MaskName,
+	"holdername":   MaskName,
+	"fathername":   MaskName,
+	"relationname": MaskName,
+	"surname":      MaskName,
+	"givenname":    MaskName,
+	"birthday":     Mask,
+	"address":      Mask,
+	"pin":          Mask,
+	"phoneno":      Mask,
+	"registno":     Mask,
+}
+
+var (
+	panPattern     = regexp.MustCompile(`\b[A-Z]{5}[0-9]{4}[A-Z]\b`)
+	aadhaarPattern = regexp.MustCompile(`\b[2-9][0-9]{3}\s?[0-9]{4}\s?[0-9]{4}\b`)
+	phonePattern   = regexp.MustCompile(`\b(\+?91)?[6-9][0-9]{9}\b`)
+	// 文本中的 "key":"value" 片段，如日志中打印的 JSON
+	jsonFieldPattern = regexp.MustCompile(`(?i)("(?:` + keyAlternation() + `)"\s*:\s*")((?:[^"\\]|\\.)*)(")`)
+)
+
+func keyAlternation() string {
+	keys := make([]string, 0, len(sensitiveKeys))
+	for key := range sensitiveKeys {
+		keys = append(keys, key)
+	}
+	return strings.Join(keys, "|")
+}
+
+// PAN 只保留前 2 位和后 2 位，如 AB******4F
+func MaskPan(pan string) string {
+	pan = strings.TrimSpace(pan)
+	if len(pan) <= 4 {
+		return strings.Repeat("*", len(pan))
+	}
+	return pan[:2] + strings.Repeat("*", len(pan)-4) + pan[len(pan)-2:]
+}
+
+// 姓名每个词只保留首字母，如 R*** K***
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(r) + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+	}
+	return strings.Join(words, " ")
+}
+
+// 只保留首尾各 1 个字符
+func Mask(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 2 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-2) + string(runes[len(runes)-1])
+}
+
+// 遮盖 JSON 中的敏感字段，无法解析时按文本处理
+func JSON(data []byte) []byte {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return []byte(String(string(data)))
+	}
+	out, err := json.Marshal(maskValue(value))
+	if err != nil {
+		return []byte(String(string(data)))
+	}
+	return out
+}
+
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok {
+				if mask, sensitive := sensitiveKeys[strings.ToLower(key)]; sensitive {
+					v[key] = mask(s)
+					continue
+				}
+			}
+			v[key] = maskValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskValue(item)
+		}
+	case string:
+		return String(v)
+	}
+	return value
+}
+
+// 遮盖文本中的 PAN、Aadhaar、手机号以及 JSON 片段中的敏感字段
+func String(s string) string {
+	s = jsonFieldPattern.ReplaceAllStringFunc(s, func(field string) string {
+		parts := jsonFieldPattern.FindStringSubmatch(field)
+		key := strings.ToLower(strings.Trim(strings.SplitN(parts[1], ":", 2)[0], `" `))
+		return parts[1] + sensitiveKeys[key](parts[2]) + parts[3]
+	})
+	s = panPattern.ReplaceAllStringFunc(s, MaskPan)
+	s = aadhaarPattern.ReplaceAllStringFunc(s, Mask)
+	return phonePattern.ReplaceAllStringFunc(s, Mask)
+}
@@ -0,0 +1,52 @@
+package redact_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/onlythinking/pug-go/pkg/redact"
+)
+
+func TestMask(t *testing.T) {
+	if got := redact.MaskPan("ABCPK1234F"); got != "AB******4F" {
+		t.Errorf("unexpected pan %s", got)
+	}
+	if got := redact.MaskName("RAVI KUMAR"); got != "R*** K****" {
+		t.Errorf("unexpected name %s", got)
+	}
+	if got := redact.Mask("15/08/1990"); got != "1********0" {
+		t.Errorf("unexpected value %s", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	raw := `{"code":"SUCCESS","data":{"cardType":"PAN_FRONT","values":{"idNumber":"ABCPK1234F","name":"RAVI KUMAR","birthday":"15/08/1990","fatherName":"RAM KUMAR"}},"transactionId":"t1"}`
+	var masked struct {
+		Code string
+		Data struct {
+			Values map[string]string
+		}
+		TransactionId string
+	}
+	if err := json.Unmarshal(redact.JSON([]byte(raw)), &masked); err != nil {
+		t.Fatal(err)
+	}
+	values := masked.Data.Values
+	if masked.Code != "SUCCESS" || masked.TransactionId != "t1" || values["idNumber"] != "AB******4F" ||
+		values["name"] != "R*** K****" || values["fatherName"] != "R** K****" || values["birthday"] != "1********0" {
+		t.Errorf("unexpected masked %#v", masked)
+	}
+}
+
+func TestString(t *testing.T) {
+	s := redact.String(`ADV_ HTTP status：500 {"idNumber": "ABCPK1234F", "name":"RAVI KUMAR"} pan ABCPK1234F phone 9876543210 aadhaar 2345 6789 0123`)
+	for _, plain := range []string{"ABCPK1234F", "RAVI KUMAR", "9876543210", "2345 6789 0123"} {
+		if strings.Contains(s, plain) {
+			t.Errorf("expected %s masked in %s", plain, s)
+		}
+	}
+	if !strings.Contains(s, "status：500") {
+		t.Errorf("unexpected %s", s)
+	}
+}